@@ -114,7 +114,7 @@ const docTemplate = `{
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/manager.FailureResponse"
+                            "$ref": "#/definitions/manager.PipelineParseFailureResponse"
                         }
                     }
                 }
@@ -225,7 +225,76 @@ const docTemplate = `{
                     "400": {
                         "description": "Bad Request",
                         "schema": {
-                            "$ref": "#/definitions/manager.FailureResponse"
+                            "$ref": "#/definitions/manager.PipelineExecuteFailureResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/manager/pipeline/plan/{pipeline_id}": {
+            "post": {
+                "description": "This method will return the tasks a job of the pipeline with the given id would run, no task is dispatched.\nInputs and conditions are evaluated where their values are known, results of tasks and of functions with access to the host like ` + "`" + `env` + "`" + ` are rendered as ` + "`" + `\u003cexpression\u003e` + "`" + `.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "pipelines"
+                ],
+                "summary": "plans a pipeline",
+                "operationId": "pipeline-plan",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Pipeline ID",
+                        "name": "pipeline_id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Request Body",
+                        "name": "plan_request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/manager.PipelinePlanRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/manager.PipelinePlanResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/manager.PipelineExecuteFailureResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/manager/pipeline/schema": {
+            "get": {
+                "description": "This method will return the JSON Schema all pipeline scripts are validated against, services are restricted to the configured services.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "pipelines"
+                ],
+                "summary": "returns the JSON Schema of pipeline scripts",
+                "operationId": "pipeline-schema",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/pipeline.Schema"
                         }
                     }
                 }
@@ -267,7 +336,7 @@ const docTemplate = `{
                 }
             },
             "patch": {
-                "description": "This method will update the given pipeline from a provided script",
+                "description": "This method will update the given pipeline from a provided script, the revision is only increased if the parsed pipeline changed",
                 "consumes": [
                     "text/plain"
                 ],
@@ -304,6 +373,110 @@ const docTemplate = `{
                             "$ref": "#/definitions/manager.PipelineDetailsResponse"
                         }
                     },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/manager.PipelineParseFailureResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/manager/secret/": {
+            "post": {
+                "description": "This method will encrypt and store the secret sent via the post body, secrets can be referenced in pipelines via ` + "`" + `secret(\"name\")` + "`" + `",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "secrets"
+                ],
+                "summary": "creates or replaces a secret",
+                "operationId": "secret-create",
+                "parameters": [
+                    {
+                        "description": "Secret",
+                        "name": "secret",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/manager.SecretCreateRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/manager.SuccessResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/manager.FailureResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/manager/secret/all": {
+            "get": {
+                "description": "This method will return the names of all secrets, the values are never returned",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "secrets"
+                ],
+                "summary": "lists the names of all secrets",
+                "operationId": "secret-list",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/manager.SecretListResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "$ref": "#/definitions/manager.FailureResponse"
+                        }
+                    }
+                }
+            }
+        },
+        "/manager/secret/{name}": {
+            "delete": {
+                "description": "This method will delete the secret with the given name",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "secrets"
+                ],
+                "summary": "deletes a secret",
+                "operationId": "secret-delete",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Secret Name",
+                        "name": "name",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/manager.SuccessResponse"
+                        }
+                    },
                     "400": {
                         "description": "Bad Request",
                         "schema": {
@@ -315,6 +488,58 @@ const docTemplate = `{
         }
     },
     "definitions": {
+        "execution.Plan": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "description": "the error the job would fail with",
+                    "type": "string"
+                },
+                "tasks": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/execution.PlannedTask"
+                    }
+                }
+            }
+        },
+        "execution.PlannedTask": {
+            "type": "object",
+            "properties": {
+                "conditional": {
+                    "description": "the task depends on a condition which is only known once the job runs",
+                    "type": "boolean"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "input": {
+                    "type": "object",
+                    "additionalProperties": true
+                },
+                "local": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "pipeline": {
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "service": {
+                    "type": "string"
+                },
+                "skipped": {
+                    "type": "boolean"
+                },
+                "stage": {
+                    "type": "string"
+                }
+            }
+        },
         "manager.FailureResponse": {
             "type": "object",
             "properties": {
@@ -365,11 +590,34 @@ const docTemplate = `{
         "manager.PipelineDetailsResponse": {
             "type": "object",
             "properties": {
+                "parameters": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/pipeline.Parameter"
+                    }
+                },
                 "pipeline": {
                     "$ref": "#/definitions/model.Pipeline"
                 }
             }
         },
+        "manager.PipelineExecuteFailureResponse": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "parameters": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/pipeline.ParameterError"
+                    }
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
         "manager.PipelineExecuteRequest": {
             "type": "object",
             "properties": {
@@ -401,6 +649,62 @@ const docTemplate = `{
                 }
             }
         },
+        "manager.PipelineParseFailureResponse": {
+            "type": "object",
+            "properties": {
+                "diagnostics": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/pipeline.Diagnostic"
+                    }
+                },
+                "error": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
+        "manager.PipelinePlanRequest": {
+            "type": "object",
+            "properties": {
+                "parameters": {
+                    "type": "object",
+                    "additionalProperties": true
+                }
+            }
+        },
+        "manager.PipelinePlanResponse": {
+            "type": "object",
+            "properties": {
+                "plan": {
+                    "$ref": "#/definitions/execution.Plan"
+                }
+            }
+        },
+        "manager.SecretCreateRequest": {
+            "type": "object",
+            "properties": {
+                "name": {
+                    "type": "string"
+                },
+                "value": {
+                    "type": "string"
+                }
+            }
+        },
+        "manager.SecretListResponse": {
+            "type": "object",
+            "properties": {
+                "secrets": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
         "manager.SuccessResponse": {
             "type": "object",
             "properties": {
@@ -429,15 +733,40 @@ const docTemplate = `{
                 "name": {
                     "type": "string"
                 },
+                "outputs": {
+                    "description": "declared outputs of the pipeline, set once the job succeeded",
+                    "type": "object",
+                    "additionalProperties": true
+                },
                 "pipeline": {
                     "$ref": "#/definitions/model.Pipeline"
                 },
+                "stages": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/model.JobStage"
+                    }
+                },
+                "status": {
+                    "type": "string"
+                },
                 "variables": {
                     "type": "object",
                     "additionalProperties": true
                 }
             }
         },
+        "model.JobStage": {
+            "type": "object",
+            "properties": {
+                "name": {
+                    "type": "string"
+                },
+                "status": {
+                    "type": "string"
+                }
+            }
+        },
         "model.Pipeline": {
             "type": "object",
             "properties": {
@@ -458,6 +787,26 @@ const docTemplate = `{
                 }
             }
         },
+        "pipeline.Diagnostic": {
+            "type": "object",
+            "properties": {
+                "column": {
+                    "type": "integer"
+                },
+                "file": {
+                    "type": "string"
+                },
+                "line": {
+                    "type": "integer"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "severity": {
+                    "type": "string"
+                }
+            }
+        },
         "pipeline.Expression": {
             "type": "object",
             "properties": {
@@ -466,16 +815,103 @@ const docTemplate = `{
                 }
             }
         },
+        "pipeline.Matrix": {
+            "type": "object",
+            "additionalProperties": true
+        },
+        "pipeline.Output": {
+            "type": "object",
+            "properties": {
+                "name": {
+                    "type": "string"
+                },
+                "source": {
+                    "$ref": "#/definitions/pipeline.Source"
+                },
+                "value": {
+                    "$ref": "#/definitions/pipeline.Expression"
+                }
+            }
+        },
+        "pipeline.Parameter": {
+            "type": "object",
+            "properties": {
+                "default": {},
+                "description": {
+                    "type": "string"
+                },
+                "enum": {
+                    "type": "array",
+                    "items": {}
+                },
+                "name": {
+                    "type": "string"
+                },
+                "pattern": {
+                    "type": "string"
+                },
+                "required": {
+                    "type": "boolean"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "pipeline.ParameterError": {
+            "type": "object",
+            "properties": {
+                "message": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
         "pipeline.Pipeline": {
             "type": "object",
             "properties": {
+                "always": {
+                    "description": "run after the job whether it failed or not",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/pipeline.Task"
+                    }
+                },
+                "handlers": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/pipeline.Task"
+                    }
+                },
                 "name": {
                     "type": "string"
                 },
+                "on_failure": {
+                    "description": "run when the job failed",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/pipeline.Task"
+                    }
+                },
+                "outputs": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/pipeline.Output"
+                    }
+                },
                 "parameters": {
                     "type": "array",
                     "items": {
-                        "type": "string"
+                        "$ref": "#/definitions/pipeline.Parameter"
+                    }
+                },
+                "pipelines": {
+                    "description": "all pipelines referenced by ` + "`" + `pipeline:` + "`" + ` tasks, only set on the root pipeline",
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/pipeline.Pipeline"
                     }
                 },
                 "stages": {
@@ -483,26 +919,206 @@ const docTemplate = `{
                     "items": {
                         "$ref": "#/definitions/pipeline.Stage"
                     }
+                },
+                "timeout": {
+                    "description": "deadline of the whole job, 0 means no deadline",
+                    "type": "string"
+                },
+                "variables": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/pipeline.Variable"
+                    }
+                }
+            }
+        },
+        "pipeline.RetryPolicy": {
+            "type": "object",
+            "properties": {
+                "backoff": {
+                    "type": "string"
+                },
+                "retries": {
+                    "type": "integer"
+                },
+                "retry_delay": {
+                    "type": "string"
+                },
+                "retry_on": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "pipeline.Schema": {
+            "type": "object",
+            "properties": {
+                "$ref": {
+                    "type": "string"
+                },
+                "$schema": {
+                    "type": "string"
+                },
+                "additionalProperties": {
+                    "description": "either false to forbid unknown keys or the schema of all unknown keys, nil allows any key"
+                },
+                "anyOf": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/pipeline.Schema"
+                    }
+                },
+                "definitions": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/pipeline.Schema"
+                    }
+                },
+                "description": {
+                    "type": "string"
+                },
+                "enum": {
+                    "type": "array",
+                    "items": {}
+                },
+                "items": {
+                    "$ref": "#/definitions/pipeline.Schema"
+                },
+                "maximum": {
+                    "type": "integer"
+                },
+                "minimum": {
+                    "type": "integer"
+                },
+                "oneOf": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/pipeline.Schema"
+                    }
+                },
+                "pattern": {
+                    "type": "string"
+                },
+                "properties": {
+                    "type": "object",
+                    "additionalProperties": {
+                        "$ref": "#/definitions/pipeline.Schema"
+                    }
+                },
+                "required": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "title": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "pipeline.Source": {
+            "type": "object",
+            "properties": {
+                "column": {
+                    "type": "integer"
+                },
+                "file": {
+                    "type": "string"
+                },
+                "line": {
+                    "type": "integer"
                 }
             }
         },
         "pipeline.Stage": {
             "type": "object",
             "properties": {
+                "always": {
+                    "description": "run after the stage whether it failed or not",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/pipeline.Task"
+                    }
+                },
+                "delay": {
+                    "description": "delay between two iterations of the stage",
+                    "type": "string"
+                },
+                "failure_policy": {
+                    "type": "string"
+                },
+                "flush_handlers": {
+                    "description": "run notified handlers at the end of this stage",
+                    "type": "boolean"
+                },
+                "matrix": {
+                    "description": "combination of the ` + "`" + `matrix` + "`" + ` the stage has been expanded from",
+                    "$ref": "#/definitions/pipeline.Matrix"
+                },
+                "max_iterations": {
+                    "description": "0 uses the default of the executor",
+                    "type": "integer"
+                },
+                "max_parallel": {
+                    "description": "0 uses the default of the executor",
+                    "type": "integer"
+                },
                 "name": {
                     "type": "string"
                 },
+                "on_failure": {
+                    "description": "run when a task of the stage failed",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/pipeline.Task"
+                    }
+                },
+                "parallel": {
+                    "type": "boolean"
+                },
+                "source": {
+                    "$ref": "#/definitions/pipeline.Source"
+                },
                 "tasks": {
                     "type": "array",
                     "items": {
                         "$ref": "#/definitions/pipeline.Task"
                     }
+                },
+                "until": {
+                    "description": "the stage is repeated until the expression is true",
+                    "$ref": "#/definitions/pipeline.Expression"
+                },
+                "variables": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/pipeline.Variable"
+                    }
+                },
+                "when": {
+                    "description": "the stage is skipped unless the expression is true",
+                    "$ref": "#/definitions/pipeline.Expression"
                 }
             }
         },
         "pipeline.Task": {
             "type": "object",
             "properties": {
+                "depends_on": {
+                    "description": "names of tasks in the same stage",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
                 "ignore_errors": {
                     "type": "boolean"
                 },
@@ -510,26 +1126,77 @@ const docTemplate = `{
                     "type": "object",
                     "additionalProperties": true
                 },
+                "items": {
+                    "description": "literal loop items",
+                    "type": "array",
+                    "items": {}
+                },
+                "local": {
+                    "description": "type of a task which is evaluated by the execution itself",
+                    "type": "string"
+                },
+                "loop": {
+                    "description": "evaluates to an array or a map",
+                    "$ref": "#/definitions/pipeline.Expression"
+                },
+                "matrix": {
+                    "description": "combination of the ` + "`" + `matrix` + "`" + ` the task has been expanded from",
+                    "$ref": "#/definitions/pipeline.Matrix"
+                },
                 "name": {
                     "type": "string"
                 },
                 "notify": {
-                    "description": "NotifyRef",
+                    "description": "names of handlers",
                     "type": "array",
                     "items": {
                         "type": "string"
                     }
                 },
+                "pipeline": {
+                    "description": "key of the sub-pipeline in the pipelines of the root pipeline",
+                    "type": "string"
+                },
                 "register": {
                     "type": "string"
                 },
+                "retry": {
+                    "$ref": "#/definitions/pipeline.RetryPolicy"
+                },
                 "service": {
                     "type": "string"
                 },
+                "source": {
+                    "$ref": "#/definitions/pipeline.Source"
+                },
+                "timeout": {
+                    "description": "timeout of a single attempt, 0 uses the default of the runner",
+                    "type": "string"
+                },
+                "variables": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/pipeline.Variable"
+                    }
+                },
                 "when": {
                     "$ref": "#/definitions/pipeline.Expression"
                 }
             }
+        },
+        "pipeline.Variable": {
+            "type": "object",
+            "properties": {
+                "name": {
+                    "type": "string"
+                },
+                "source": {
+                    "$ref": "#/definitions/pipeline.Source"
+                },
+                "value": {
+                    "type": "string"
+                }
+            }
         }
     }
 }`
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// exit codes of all commands
+const (
+	exitOk       = 0
+	exitProblems = 1 // the command found problems in the given pipelines
+	exitUsage    = 2 // the command could not be run
+)
+
+type command struct {
+	name        string
+	description string
+	run         func(args []string) int
+}
+
+var commands = []command{
+	{"lint", "checks pipeline scripts without executing them", lintCommand},
+	{"fmt", "formats pipeline scripts canonically", fmtCommand},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: dips <command> [arguments]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", cmd.name, cmd.description)
+	}
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(exitUsage)
+	}
+
+	for _, cmd := range commands {
+		if cmd.name == os.Args[1] {
+			os.Exit(cmd.run(os.Args[2:]))
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "dips: unknown command `%s`\n", os.Args[1])
+	usage()
+	os.Exit(exitUsage)
+}
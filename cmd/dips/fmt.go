@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/ko1N/dips/pkg/pipeline"
+)
+
+// fmtCommand - formats all given pipelines canonically
+// the formatted pipelines are written to stdout unless `-w` or `-l` is given
+func fmtCommand(args []string) int {
+	flags := flag.NewFlagSet("fmt", flag.ContinueOnError)
+	writePtr := flags.Bool("w", false, "write the result to the pipeline files instead of stdout")
+	listPtr := flags.Bool("l", false, "list pipelines whose formatting differs and exit non-zero if there are any")
+	servicesPtr := flags.String("services", "", "service catalog (yaml), defaults to the services of this repository")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: dips fmt [flags] <pipeline>...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return exitUsage
+	}
+
+	catalog := &pipeline.DefaultServiceCatalog
+	if *servicesPtr != "" {
+		var err error
+		catalog, err = readServiceCatalog(*servicesPtr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "dips: unable to read service catalog: %s\n", err)
+			return exitUsage
+		}
+	}
+
+	result := exitOk
+	for _, file := range flags.Args() {
+		contents, err := ioutil.ReadFile(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "dips: %s\n", err)
+			return exitUsage
+		}
+
+		formatted, err := pipeline.NewParser().
+			Loader(pipeline.FileLoader{}).
+			Catalog(catalog).
+			Format(filepath.Clean(file), string(contents))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			result = exitProblems
+			continue
+		}
+
+		changed := !bytes.Equal(contents, formatted)
+		switch {
+		case *listPtr:
+			if changed {
+				fmt.Println(file)
+				result = exitProblems
+			}
+		case *writePtr:
+			if changed {
+				if err := ioutil.WriteFile(file, formatted, 0644); err != nil {
+					fmt.Fprintf(os.Stderr, "dips: %s\n", err)
+					return exitUsage
+				}
+			}
+		default:
+			os.Stdout.Write(formatted)
+		}
+	}
+	return result
+}
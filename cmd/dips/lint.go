@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/ko1N/dips/pkg/pipeline"
+	"gopkg.in/yaml.v3"
+)
+
+// lintCommand - parses and lints all given pipelines
+// all diagnostics are written to stdout, either one per line or as a json array
+func lintCommand(args []string) int {
+	flags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	servicesPtr := flags.String("services", "", "service catalog (yaml), defaults to the services of this repository")
+	formatPtr := flags.String("format", "text", "output format, text or json")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: dips lint [flags] <pipeline>...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() == 0 || (*formatPtr != "text" && *formatPtr != "json") {
+		flags.Usage()
+		return exitUsage
+	}
+
+	catalog := &pipeline.DefaultServiceCatalog
+	if *servicesPtr != "" {
+		var err error
+		catalog, err = readServiceCatalog(*servicesPtr)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "dips: unable to read service catalog: %s\n", err)
+			return exitUsage
+		}
+	}
+
+	diags := pipeline.Diagnostics{}
+	for _, file := range flags.Args() {
+		d, err := lintFile(file, catalog)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "dips: %s\n", err)
+			return exitUsage
+		}
+		diags = append(diags, d...)
+	}
+
+	if *formatPtr == "json" {
+		out, _ := json.MarshalIndent(diags, "", "  ")
+		fmt.Println(string(out))
+	} else {
+		for _, diag := range diags {
+			fmt.Println(diag.String())
+		}
+	}
+
+	// warnings are reported, but do not fail the command
+	if diags.HasErrors() {
+		return exitProblems
+	}
+	return exitOk
+}
+
+// lintFile - returns the diagnostics of the parser or, if the pipeline could be parsed, of the linter
+func lintFile(file string, catalog *pipeline.ServiceCatalog) (pipeline.Diagnostics, error) {
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	file = filepath.Clean(file)
+	pi, err := pipeline.NewParser().
+		Loader(pipeline.FileLoader{}).
+		Catalog(catalog).
+		Parse(file, string(contents))
+	if err != nil {
+		if diags, ok := err.(pipeline.Diagnostics); ok {
+			return diags, nil
+		}
+		return pipeline.Diagnostics{{File: file, Severity: pipeline.SeverityError, Message: err.Error()}}, nil
+	}
+
+	return pipeline.Lint(pi, file, catalog), nil
+}
+
+func readServiceCatalog(filename string) (*pipeline.ServiceCatalog, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var catalog pipeline.ServiceCatalog
+	err = yaml.Unmarshal(contents, &catalog)
+	if err != nil {
+		return nil, err
+	}
+	return &catalog, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// lint - runs `dips lint` with the given arguments and returns its exit code and output
+func lint(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("unable to capture stdout: %s", err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	code := lintCommand(args)
+	os.Stdout = stdout
+	w.Close()
+
+	out, _ := ioutil.ReadAll(r)
+	return code, string(out)
+}
+
+func writePipeline(t *testing.T, script string) string {
+	t.Helper()
+	file := filepath.Join(t.TempDir(), "test.pipe")
+	if err := ioutil.WriteFile(file, []byte(script), 0644); err != nil {
+		t.Fatalf("unable to write pipeline: %s", err)
+	}
+	return file
+}
+
+func TestLintWarningsOnly(t *testing.T) {
+	file := writePipeline(t, `---
+stages:
+- stage: s
+  tasks:
+  - shell: echo
+    register: unused
+`)
+
+	code, out := lint(t, file)
+	if code != exitOk {
+		t.Errorf("exit code = %d, expected %d for warnings only", code, exitOk)
+	}
+	if !strings.Contains(out, "warning: registered result `unused` is never used") {
+		t.Errorf("the warning has not been printed:\n%s", out)
+	}
+}
+
+func TestLintErrors(t *testing.T) {
+	file := writePipeline(t, `---
+stages:
+- stage: s
+  tasks:
+  - shell: "echo {{ missing }}"
+    register: unused
+`)
+
+	code, out := lint(t, file)
+	if code != exitProblems {
+		t.Errorf("exit code = %d, expected %d", code, exitProblems)
+	}
+	if !strings.Contains(out, "missing") || !strings.Contains(out, "warning:") {
+		t.Errorf("expected the error and the warning, got:\n%s", out)
+	}
+
+	if code, _ := lint(t, filepath.Join(t.TempDir(), "missing.pipe")); code != exitUsage {
+		t.Errorf("exit code = %d for a missing file, expected %d", code, exitUsage)
+	}
+}
+
+func TestLintServiceCatalog(t *testing.T) {
+	file := writePipeline(t, "---\nstages:\n- stage: s\n  tasks:\n  - service: {name: ffprobe, source: a.mp4}\n")
+	catalog := filepath.Join(t.TempDir(), "services.yml")
+	if err := ioutil.WriteFile(catalog, []byte("services:\n- name: shell\n  input: cmd\n"), 0644); err != nil {
+		t.Fatalf("unable to write catalog: %s", err)
+	}
+
+	if code, out := lint(t, file); code != exitOk {
+		t.Errorf("default catalog: exit code = %d:\n%s", code, out)
+	}
+	code, out := lint(t, "-services", catalog, file)
+	if code != exitProblems || !strings.Contains(out, "unknown service `ffprobe`") {
+		t.Errorf("custom catalog: exit code = %d:\n%s", code, out)
+	}
+}
+
+func TestLintTestPipelines(t *testing.T) {
+	files, err := filepath.Glob("../../test/*.pipe")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no test pipelines found: %v", err)
+	}
+	if code, out := lint(t, files...); code != exitOk {
+		t.Errorf("exit code = %d, expected the test pipelines to be free of errors:\n%s", code, out)
+	}
+}
@@ -1,45 +1,119 @@
 package main
 
 import (
+	"encoding/json"
 	"flag"
+	"fmt"
 	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 
 	log "github.com/inconshreveable/log15"
+	"gopkg.in/yaml.v3"
 
+	"github.com/ko1N/dips/pkg/execution"
+	"github.com/ko1N/dips/pkg/execution/tracking"
 	"github.com/ko1N/dips/pkg/pipeline"
-	"github.com/ko1N/dips/pkg/pipeline/tracking"
 )
 
+// params - parameters given as `-param key=value`, values are coerced into the type of the parameter
+type params map[string]interface{}
+
+func (p params) String() string {
+	return fmt.Sprint(map[string]interface{}(p))
+}
+
+func (p params) Set(value string) error {
+	kv := strings.SplitN(value, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return fmt.Errorf("parameter `%s` must be of the form key=value", value)
+	}
+	p[kv[0]] = kv[1]
+	return nil
+}
+
 func main() {
+	parameters := make(params)
 	pipelinePtr := flag.String("pipeline", "", "the pipeline to execute")
+	varsPtr := flag.String("vars", "", "yaml or json file with the parameters of the job")
+	flag.Var(parameters, "param", "parameter of the job as key=value, can be repeated and overrides the parameters of -vars")
+	planPtr := flag.Bool("plan", false, "print the tasks the pipeline would run as json instead of executing it")
+	envPtr := flag.String("env", "", "comma separated environment variables expressions can read with `env`, entries ending with `*` are prefixes")
 	flag.Parse()
 
+	if *envPtr != "" {
+		pipeline.AllowEnv(strings.Split(*envPtr, ",")...)
+	}
+	pipeline.LimitStrings(pipeline.DefaultExpressionLimits.MaxStringLen)
+
 	// setup engine
 	srvlog := log.New("cmd", "worker")
 
-	// create logging instance for this pipeline
-	tracker := tracking.CreateJobTracker(tracking.JobTrackerConfig{
-		Logger: srvlog,
-		Client: nil,
-		JobID:  "manual",
-	})
+	// create logging instance for this pipeline, a plan is printed without the log of the job
+	var tracker tracking.JobTracker
+	if *planPtr {
+		tracker = tracking.CreateDiscardTracker("manual")
+	} else {
+		tracker = tracking.CreateJobTracker(srvlog, nil, "manual")
+	}
 
 	// parse pipeline
 	content, err := ioutil.ReadFile(*pipelinePtr)
 	if err != nil {
 		srvlog.Crit("unable to open pipeline script file", "error", err)
+		return
 	}
 
-	pi, err := pipeline.CreateFromBytes(content)
+	pi, err := pipeline.NewParser().
+		Loader(pipeline.FileLoader{}).
+		Parse(filepath.Clean(*pipelinePtr), string(content))
 	if err != nil {
 		srvlog.Crit("unable to create pipeline from bytes", "error", err)
+		return
+	}
+
+	// parameters are validated the same way as for an execution by the manager
+	values := make(map[string]interface{})
+	if *varsPtr != "" {
+		content, err := ioutil.ReadFile(*varsPtr)
+		if err != nil {
+			srvlog.Crit("unable to open parameters file", "error", err)
+			os.Exit(1)
+		}
+		if err := yaml.Unmarshal(content, &values); err != nil {
+			srvlog.Crit("unable to parse parameters file", "error", err)
+			os.Exit(1)
+		}
+	}
+	for key, value := range parameters {
+		values[key] = value
+	}
+	variables, err := pi.ValidateParameters(values)
+	if err != nil {
+		srvlog.Crit("invalid parameters", "error", err)
+		os.Exit(1)
 	}
 
 	// execute pipeline on engine
-	exec := pipeline.NewExecutionContext(
+	exec := execution.NewExecutionContext(
 		"manual",
 		pi,
-		tracker)
+		tracker).
+		Variables(variables)
+	if *planPtr {
+		plan, err := exec.Plan()
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(plan)
+		if err != nil {
+			srvlog.Crit("pipeline would fail", "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	err = exec.Run()
 	if err != nil {
 		srvlog.Crit("unable to execute pipeline", "error", err)
@@ -1,10 +1,13 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"io/ioutil"
 	"time"
 
+	"github.com/ko1N/dips/internal/persistence/database"
+	"github.com/ko1N/dips/internal/persistence/secrets"
 	"github.com/ko1N/dips/pkg/dipscl"
 	"github.com/ko1N/dips/pkg/execution"
 	"github.com/ko1N/dips/pkg/execution/tracking"
@@ -15,18 +18,47 @@ import (
 )
 
 type Config struct {
-	Dips DipsConfig `yaml:"dips"`
+	Dips      DipsConfig             `yaml:"dips"`
+	Execution ExecutionConfig        `yaml:"execution"`
+	MongoDB   database.MongoDBConfig `yaml:"mongodb"`
+	Secrets   secrets.SecretsConfig  `yaml:"secrets"`
 }
 
 type DipsConfig struct {
 	Host string `yaml:"host"`
 }
 
+type ExecutionConfig struct {
+	// default amount of tasks of a parallel stage that are dispatched at once
+	MaxParallel int `yaml:"max_parallel"`
+	// timeout of tasks which do not specify `timeout` themselves
+	TaskTimeout time.Duration `yaml:"task_timeout"`
+	// retries of tasks of services which do not specify `retries` themselves
+	Retries int `yaml:"retries"`
+	// amount of sub-pipelines which can be nested into each other
+	MaxPipelineDepth int `yaml:"max_pipeline_depth"`
+	// limits of every evaluation of an expression, e.g. a `when` condition
+	Expressions pipeline.ExpressionLimits `yaml:"expressions"`
+	// environment variables expressions can read with `env`, entries ending with `*` are prefixes
+	Env []string `yaml:"env"`
+}
+
 func readConfig(filename string) (*Config, error) {
 	fallback := Config{
 		Dips: DipsConfig{
 			Host: "rabbitmq:rabbitmq@localhost",
 		},
+		Execution: ExecutionConfig{
+			MaxParallel:      4,
+			TaskTimeout:      12 * time.Hour,
+			Retries:          3,
+			MaxPipelineDepth: 8,
+			Expressions:      pipeline.DefaultExpressionLimits,
+		},
+		MongoDB: database.MongoDBConfig{
+			Hosts:         []string{"mongodb://localhost:27017"},
+			AuthMechanism: "SCRAM-SHA-256",
+		},
 	}
 
 	contents, err := ioutil.ReadFile(filename)
@@ -34,7 +66,8 @@ func readConfig(filename string) (*Config, error) {
 		return &fallback, nil
 	}
 
-	var conf Config
+	// settings missing in the config file keep their default
+	conf := fallback
 	err = yaml.Unmarshal([]byte(contents), &conf)
 	if err != nil {
 		return &fallback, nil
@@ -48,15 +81,36 @@ func main() {
 		panic(err)
 	}
 
+	pipeline.AllowEnv(conf.Execution.Env...)
+	pipeline.LimitStrings(conf.Execution.Expressions.MaxStringLen)
+
 	cl, err := dipscl.NewClient(conf.Dips.Host)
 	if err != nil {
 		panic(err)
 	}
 
+	// secrets are read from the store of the manager, pipelines cannot reference secrets without a key
+	var secretStore *secrets.SecretStore
+	if conf.Secrets.Key == "" {
+		log.Warn("no secret key configured, jobs using `secret` will fail")
+	} else {
+		if conf.MongoDB.Database == "" {
+			panic("the secret store requires the `mongodb` database of the manager in config.yml")
+		}
+		mongo, err := database.MongoDBConnect(&conf.MongoDB)
+		if err != nil {
+			panic(err)
+		}
+		secretStore, err = secrets.CreateSecretStore(mongo, &conf.Secrets)
+		if err != nil {
+			panic(err)
+		}
+	}
+
 	// TODO: configure concurrency, timeouts, etc
 	cl.NewJobWorker().
 		Concurrency(10).
-		Handler(handleJob).
+		Handler(jobHandler(&conf.Execution, secretStore)).
 		Run()
 
 	signal := make(chan struct{})
@@ -65,52 +119,74 @@ func main() {
 
 // TODO: send status updates containing log messages
 // TODO: send status updates containing raw cmd exec log
-func handleJob(job *dipscl.JobContext) error {
+func jobHandler(conf *ExecutionConfig, secretStore *secrets.SecretStore) func(*dipscl.JobContext) error {
+	return func(job *dipscl.JobContext) error {
+		return handleJob(conf, secretStore, job)
+	}
+}
+
+func handleJob(conf *ExecutionConfig, secretStore *secrets.SecretStore, job *dipscl.JobContext) error {
 	// create logging instance for this pipeline
 	tracker := tracking.CreateJobTracker(log.New("cmd", "worker"), job.Client, job.Request.Job.Id.Hex())
 
-	pi, err := pipeline.CreateFromBytes(job.Request.Job.Pipeline.Script)
-	if err != nil {
-		tracker.Crit("unable to create pipeline from bytes", "error", err)
-		return errors.New("Unable to create pipeline from bytes")
+	// the manager already resolved all references of the pipeline
+	pi := job.Request.Job.Pipeline.Pipeline
+	if pi == nil {
+		var err error
+		pi, err = pipeline.CreateFromBytes(job.Request.Job.Pipeline.Script)
+		if err != nil {
+			tracker.Crit("unable to create pipeline from bytes", "error", err)
+			return errors.New("Unable to create pipeline from bytes")
+		}
+	} else if err := pi.Compile(); err != nil {
+		// the pipeline has been decoded from the job, its expressions have to be compiled again
+		tracker.Crit("unable to compile pipeline", "error", err)
+		return errors.New("Unable to compile pipeline")
 	}
 
 	// execute pipeline on engine
 	exec := execution.
 		NewExecutionContext(job.Request.Job.Id.Hex(), pi, tracker).
 		Variables(job.Request.Job.Variables).
-		TaskHandler(func(task *pipeline.Task, input map[string]string) (*execution.ExecutionResult, error) {
-			retries := 3
-			for {
-				result, err := job.Client.
-					NewTask(task.Service).
-					Name(task.Name).
-					Job(job.Request.Job).
-					Timeout(12 * 3600 * time.Second). // TODO: timeout should be configurable
-					Parameters(input).
-					Dispatch().
-					Await()
-				if err != nil {
-					if retries > 0 {
-						retries--
-						time.Sleep(1 * time.Second)
-						continue
-					} else {
-						return nil, err
-					}
-				}
-				return &execution.ExecutionResult{
-					Success: result.Error == nil,
-					Error:   result.Error,
-					Output:  result.Output,
-				}, nil
+		MaxParallel(conf.MaxParallel).
+		MaxDepth(conf.MaxPipelineDepth).
+		DefaultRetries(conf.Retries).
+		ExpressionLimits(conf.Expressions).
+		TaskHandler(func(ctx context.Context, task *pipeline.Task, input map[string]interface{}) (*execution.ExecutionResult, error) {
+			timeout := conf.TaskTimeout
+			if task.Timeout > 0 {
+				timeout = time.Duration(task.Timeout)
 			}
+
+			// retries are handled by the execution according to the retry policy of the task
+			result, err := job.Client.
+				NewTask(task.Service).
+				Context(ctx).
+				Name(task.Name).
+				Job(job.Request.Job).
+				Timeout(timeout).
+				Parameters(input).
+				Dispatch().
+				Await()
+			if err != nil {
+				return nil, err
+			}
+			return &execution.ExecutionResult{
+				Success: result.Error == nil,
+				Error:   result.Error,
+				Output:  result.Output,
+			}, nil
 		})
 
+	// without a secret store every use of `secret` fails the job
+	if secretStore != nil {
+		exec.Secrets(secretStore.Get)
+	}
+
 	// run execution
-	err = exec.Run()
+	err := exec.Run()
 	if err != nil {
-		tracker.Crit("error while executing pipeline: %s", err)
+		tracker.Crit("error while executing pipeline", "error", err)
 	}
 
 	return nil
@@ -15,8 +15,10 @@ import (
 	_ "github.com/ko1N/dips/api/manager"
 	"github.com/ko1N/dips/internal/persistence/database"
 	"github.com/ko1N/dips/internal/persistence/messages"
+	"github.com/ko1N/dips/internal/persistence/secrets"
 	"github.com/ko1N/dips/internal/rest/manager"
 	"github.com/ko1N/dips/pkg/dipscl"
+	"github.com/ko1N/dips/pkg/pipeline"
 )
 
 // @title dips
@@ -32,6 +34,8 @@ type Config struct {
 	Dips     DipsConfig              `yaml:"dips"`
 	MongoDB  database.MongoDBConfig  `yaml:"mongodb"`
 	InfluxDB database.InfluxDBConfig `yaml:"influxdb"`
+	Secrets  secrets.SecretsConfig   `yaml:"secrets"`
+	Services []pipeline.Service      `yaml:"services"` // defaults to the services of this repository
 }
 
 type DipsConfig struct {
@@ -97,6 +101,15 @@ func main() {
 		panic(err)
 	}
 
+	// setup secrets, pipelines cannot reference secrets without a key
+	var secretStore *secrets.SecretStore
+	if conf.Secrets.Key != "" {
+		secretStore, err = secrets.CreateSecretStore(mongo, &conf.Secrets)
+		if err != nil {
+			panic(err)
+		}
+	}
+
 	// setup web service
 	r := gin.Default()
 
@@ -107,7 +120,11 @@ func main() {
 
 	// setup manager api
 	messageHandler := messages.CreateMessageHandler(influxdb, conf.InfluxDB.Database)
-	_, err = manager.CreateManagerAPI(r, cl, mongo, messageHandler)
+	catalog := pipeline.DefaultServiceCatalog
+	if len(conf.Services) > 0 {
+		catalog = pipeline.ServiceCatalog{Services: conf.Services}
+	}
+	_, err = manager.CreateManagerAPI(r, cl, mongo, messageHandler, secretStore, &catalog)
 	if err != nil {
 		panic(err)
 	}
@@ -46,7 +46,9 @@ func main() {
 		srvlog.Crit("unable to open pipeline script file", "error", err)
 		return
 	}
-	_, err = pipeline.CreateFromBytes(string(contents))
+	_, err = pipeline.NewParser().
+		Loader(pipeline.FileLoader{}).
+		Parse(*pipelinePtr, string(contents))
 	if err != nil {
 		srvlog.Crit("unable to parse pipeline script file", "error", err)
 		return
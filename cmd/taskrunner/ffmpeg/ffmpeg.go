@@ -101,7 +101,10 @@ func ffprobeHandler(conf *FFmpegConfig) func(*dipscl.TaskContext) (map[string]in
 			task.Request.TaskID)
 
 		// input video
-		source := task.Request.Params["source"]
+		source, err := task.StringInput("source")
+		if err != nil {
+			return nil, err
+		}
 		if source == "" {
 			return nil, fmt.Errorf("`source` variable must not be empty")
 		}
@@ -130,7 +133,7 @@ func ffprobeHandler(conf *FFmpegConfig) func(*dipscl.TaskContext) (map[string]in
 }
 
 func executeFFmpegProbe(task *dipscl.TaskContext, conf *FFmpegConfig, tracker *tracking.JobTracker, filename string) (map[string]interface{}, error) {
-	tracker.Info("probing input file: %s", filename)
+	tracker.Info("probing input file", "file", filename)
 
 	// probe inputs
 	executable := "ffprobe"
@@ -150,7 +153,7 @@ func executeFFmpegProbe(task *dipscl.TaskContext, conf *FFmpegConfig, tracker *t
 			tracker.StdErr(errmsg)
 		})
 	if err != nil {
-		tracker.Crit("unable to execute ffprobe: %s", err)
+		tracker.Crit("unable to execute ffprobe", "error", err)
 		return nil, err
 	}
 
@@ -179,30 +182,44 @@ func ffmpegHandler(conf *FFmpegConfig) func(*dipscl.TaskContext) (map[string]int
 			task.Request.TaskID)
 
 		// inputs + outputs
-		source := task.Request.Params["source"]
+		source, err := task.StringInput("source")
+		if err != nil {
+			return nil, err
+		}
 		if source == "" {
 			return nil, fmt.Errorf("`source` variable must not be empty")
 		}
 
-		target := task.Request.Params["target"]
-		if target == "" {
-			return nil, fmt.Errorf("`target` variable must not be empty")
-		}
-
 		sourceUrl, err := taskstorage.ParseFileUrl(source)
 		if err != nil {
 			return nil, fmt.Errorf("unable to parse url in `source` variable: %s", err.Error())
 		}
 
-		targetUrl, err := taskstorage.ParseFileUrl(target)
+		err = task.Filesystem.AddInput(sourceUrl)
 		if err != nil {
-			return nil, fmt.Errorf("unable to parse url in `target` variable: %s", err.Error())
+			return nil, fmt.Errorf("unable to add input file '%s': %s", sourceUrl.URL.String(), err.Error())
 		}
 
-		// add input + output
-		err = task.Filesystem.AddInput(sourceUrl)
+		// a list of outputs replaces the single `target` and its packed `args`
+		outputs, err := task.ListInput("outputs")
 		if err != nil {
-			return nil, fmt.Errorf("unable to add input file '%s': %s", sourceUrl.URL.String(), err.Error())
+			return nil, err
+		}
+		if len(outputs) > 0 {
+			return ffmpegOutputs(task, conf, &tracker, sourceUrl, outputs)
+		}
+
+		target, err := task.StringInput("target")
+		if err != nil {
+			return nil, err
+		}
+		if target == "" {
+			return nil, fmt.Errorf("`target` variable must not be empty")
+		}
+
+		targetUrl, err := taskstorage.ParseFileUrl(target)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse url in `target` variable: %s", err.Error())
 		}
 
 		err = task.Filesystem.AddOutput(targetUrl)
@@ -215,7 +232,11 @@ func ffmpegHandler(conf *FFmpegConfig) func(*dipscl.TaskContext) (map[string]int
 			Source: sourceUrl.FilePath,
 			Target: targetUrl.FilePath,
 		}
-		argsstr := strings.Replace(strings.Replace(task.Request.Params["args"], "[", "{{.", -1), "]", "}}", -1)
+		argsinput, err := task.StringInput("args")
+		if err != nil {
+			return nil, err
+		}
+		argsstr := strings.Replace(strings.Replace(argsinput, "[", "{{.", -1), "]", "}}", -1)
 		argtpl, err := template.New("args").Parse(argsstr)
 		if err != nil {
 			return nil, fmt.Errorf("invalid ffmpeg args: %s", err)
@@ -240,6 +261,71 @@ func ffmpegHandler(conf *FFmpegConfig) func(*dipscl.TaskContext) (map[string]int
 	}
 }
 
+// ffmpegOutputs - transcodes the source into all outputs with a single ffmpeg invocation
+// each output is a map with a `target` url and its `args` as a string or a list of arguments
+func ffmpegOutputs(task *dipscl.TaskContext, conf *FFmpegConfig, tracker *tracking.JobTracker, sourceUrl *taskstorage.FileUrl, outputs []interface{}) (map[string]interface{}, error) {
+	cmd := "-i " + shellQuote(sourceUrl.FilePath)
+	targets := make([]interface{}, 0, len(outputs))
+	for i, entry := range outputs {
+		output, ok := entry.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("output %d must be a map with `target` and `args`", i)
+		}
+
+		target, ok := output["target"].(string)
+		if !ok || target == "" {
+			return nil, fmt.Errorf("output %d requires a `target`", i)
+		}
+		targetUrl, err := taskstorage.ParseFileUrl(target)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse url in `target` of output %d: %s", i, err.Error())
+		}
+		err = task.Filesystem.AddOutput(targetUrl)
+		if err != nil {
+			return nil, fmt.Errorf("unable to add output file '%s': %s", targetUrl.URL.String(), err.Error())
+		}
+
+		switch args := output["args"].(type) {
+		case nil:
+		case string:
+			cmd += " " + args
+		case []interface{}:
+			for j, arg := range args {
+				s, ok := dipscl.ScalarString(arg)
+				if !ok {
+					return nil, fmt.Errorf("argument %d of output %d must be a string or a number", j, i)
+				}
+				cmd += " " + shellQuote(s)
+			}
+		default:
+			return nil, fmt.Errorf("`args` of output %d must be a string or a list", i)
+		}
+		cmd += " " + shellQuote(targetUrl.FilePath)
+		targets = append(targets, target)
+	}
+
+	err := executeFFmpegTranscode(task, conf, tracker, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg failed: %s", err.Error())
+	}
+
+	tracker.Info("ffmpeg-transcode successful", "outputs", len(targets))
+	return map[string]interface{}{
+		"targets": targets,
+	}, nil
+}
+
+// shellQuote - quotes the argument for the subshell ffmpeg is executed in
+func shellQuote(arg string) string {
+	if arg != "" && strings.IndexFunc(arg, func(r rune) bool {
+		return !(r == '-' || r == '_' || r == '.' || r == '/' || r == ':' || r == '=' ||
+			(r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9'))
+	}) < 0 {
+		return arg
+	}
+	return "'" + strings.Replace(arg, "'", `'"'"'`, -1) + "'"
+}
+
 func executeFFmpegTranscode(task *dipscl.TaskContext, conf *FFmpegConfig, tracker *tracking.JobTracker, cmd string) error {
 	tracker.Info("probing input files")
 	duration, err := estimateDuration(task, conf, tracker, cmd)
@@ -252,7 +338,7 @@ func executeFFmpegTranscode(task *dipscl.TaskContext, conf *FFmpegConfig, tracke
 	// due to the nature of sending a custom command line
 	// to the sub-process we want to run it in a seperate subshell
 	// so commands are being executed properly
-	tracker.Info("executing ffmpeg: %s", cmd)
+	tracker.Info("executing ffmpeg", "args", cmd)
 	executable := "ffmpeg"
 	if conf != nil {
 		executable = conf.FFmpegExecutable
@@ -300,7 +386,7 @@ func estimateDuration(task *dipscl.TaskContext, conf *FFmpegConfig, tracker *tra
 	parser := flags.NewParser(&opts, flags.IgnoreUnknown)
 	_, err := parser.ParseArgs(strings.Split(cmd, " "))
 	if err != nil {
-		tracker.Crit("unable to parse input command line `%s`", cmd)
+		tracker.Crit("unable to parse input command line", "args", cmd)
 		return 0, err
 	}
 
@@ -329,6 +415,6 @@ func estimateDuration(task *dipscl.TaskContext, conf *FFmpegConfig, tracker *tra
 		return 0, errors.New("unable to parse ffprobe result")
 	}
 
-	tracker.Info("input file length: %f", duration)
+	tracker.Info("input file length", "duration", duration)
 	return duration, nil
 }
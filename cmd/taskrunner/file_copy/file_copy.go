@@ -74,12 +74,18 @@ func fileCopyHandler(task *dipscl.TaskContext) (map[string]interface{}, error) {
 		task.Request.Job.Id.Hex(),
 		task.Request.TaskID)
 
-	source := task.Request.Params["source"]
+	source, err := task.StringInput("source")
+	if err != nil {
+		return nil, err
+	}
 	if source == "" {
 		return nil, fmt.Errorf("`source` variable must not be empty")
 	}
 
-	target := task.Request.Params["target"]
+	target, err := task.StringInput("target")
+	if err != nil {
+		return nil, err
+	}
 	if target == "" {
 		return nil, fmt.Errorf("`target` variable must not be empty")
 	}
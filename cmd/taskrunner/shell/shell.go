@@ -73,7 +73,10 @@ func shellHandler(task *dipscl.TaskContext) (map[string]interface{}, error) {
 		task.Request.Job.Id.Hex(),
 		task.Request.TaskID)
 
-	executable := task.Request.Params["cmd"]
+	executable, err := task.StringInput("cmd")
+	if err != nil {
+		return nil, err
+	}
 	cmdline := strings.Split(executable, " ")
 
 	res, err := task.Environment.Execute(
@@ -85,7 +88,7 @@ func shellHandler(task *dipscl.TaskContext) (map[string]interface{}, error) {
 			tracker.StdErr(errmsg)
 		})
 	if err != nil {
-		tracker.Crit("unable to execute shell command: %s", err)
+		tracker.Crit("unable to execute shell command", "error", err)
 		return nil, err
 	}
 
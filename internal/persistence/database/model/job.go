@@ -1,6 +1,10 @@
 package model
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+	"github.com/ko1N/dips/pkg/pipeline"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 // TODO: each job should contain all stages as a sublist when being inserted/parsed
 // TODO: each stage should track progress individually + total job progress (tasknum / totaltasks)
@@ -10,10 +14,57 @@ import "go.mongodb.org/mongo-driver/bson/primitive"
 // TODO: cross reference pipeline from job...
 // TODO: would it be better to copy a pipeline here so if we change the pipeline this job wont be affected?
 
+// JobStatus - The state a job is in
+type JobStatus string
+
+const (
+	JobQueued    JobStatus = "queued"
+	JobRunning   JobStatus = "running"
+	JobSucceeded JobStatus = "succeeded"
+	JobFailed    JobStatus = "failed"
+	JobTimedOut  JobStatus = "timed_out"
+)
+
+// StageStatus - The state a stage of a job is in
+type StageStatus string
+
+const (
+	StageRunning   StageStatus = "running"
+	StageSucceeded StageStatus = "succeeded"
+	StageFailed    StageStatus = "failed"
+	StageSkipped   StageStatus = "skipped"
+)
+
+// JobStage - The status of a stage of a job, stages are listed once they have been started or skipped
+type JobStage struct {
+	Name   string      `json:"name" bson:"name"`
+	Status StageStatus `json:"status" bson:"status"`
+}
+
 // Job - Database struct describing a pipeline job
 type Job struct {
 	Id        *primitive.ObjectID    `json:"id" bson:"_id,omitempty"`
 	Name      string                 `json:"name" bson:"name"`
+	Status    JobStatus              `json:"status" bson:"status"`
 	Variables map[string]interface{} `json:"variables" bson:"variables"`
+	Outputs   map[string]interface{} `json:"outputs" bson:"outputs,omitempty"` // declared outputs of the pipeline, set once the job succeeded
+	Stages    []JobStage             `json:"stages" bson:"stages,omitempty"`
 	Pipeline  *Pipeline              `json:"pipeline" bson:"pipeline"`
 }
+
+// UnmarshalBSON - converts the variables and outputs into plain go maps and slices
+func (j *Job) UnmarshalBSON(data []byte) error {
+	type job Job
+	var v job
+	if err := bson.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*j = Job(v)
+	for key, value := range j.Variables {
+		j.Variables[key] = pipeline.FromBSON(value)
+	}
+	for key, value := range j.Outputs {
+		j.Outputs[key] = pipeline.FromBSON(value)
+	}
+	return nil
+}
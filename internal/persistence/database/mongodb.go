@@ -23,16 +23,18 @@ func MongoDBConnect(conf *MongoDBConfig) (*mongo.Database, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	credential := options.Credential{
-		AuthMechanism: conf.AuthMechanism,
-		AuthSource:    conf.AuthSource,
-		Username:      conf.Username,
-		Password:      conf.Password,
-	}
 	clientOpts := options.
 		Client().
-		ApplyURI(conf.Hosts[0]).
-		SetAuth(credential)
+		ApplyURI(conf.Hosts[0])
+	// without a username the credentials of the uri are used
+	if conf.Username != "" {
+		clientOpts.SetAuth(options.Credential{
+			AuthMechanism: conf.AuthMechanism,
+			AuthSource:    conf.AuthSource,
+			Username:      conf.Username,
+			Password:      conf.Password,
+		})
+	}
 
 	mongo, err := mongo.Connect(ctx, clientOpts)
 	if err != nil {
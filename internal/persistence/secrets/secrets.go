@@ -0,0 +1,140 @@
+package secrets
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const mongoTimeout = 5 * time.Second
+const colSecrets = "secrets"
+
+// ErrNotFound - returned when no secret with the given name exists
+var ErrNotFound = errors.New("secret not found")
+
+// SecretsConfig - config entry describing the secret store
+type SecretsConfig struct {
+	// passphrase used to derive the key which encrypts all secrets
+	Key string `json:"key" toml:"key" yaml:"key"`
+}
+
+// SecretStore - stores secrets encrypted with AES-GCM in mongodb
+type SecretStore struct {
+	collection *mongo.Collection
+	aead       cipher.AEAD
+}
+
+// secret - the database entry of a single secret, the nonce is prepended to the encrypted value
+type secret struct {
+	Name  string `bson:"name"`
+	Value []byte `bson:"value"`
+}
+
+// CreateSecretStore - creates a new secret store which encrypts all values with the configured key
+func CreateSecretStore(db *mongo.Database, conf *SecretsConfig) (*SecretStore, error) {
+	if conf.Key == "" {
+		return nil, errors.New("secret store requires a key")
+	}
+
+	key := sha256.Sum256([]byte(conf.Key))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SecretStore{
+		collection: db.Collection(colSecrets),
+		aead:       aead,
+	}, nil
+}
+
+// Store - encrypts the value and creates or replaces the secret with the given name
+func (s *SecretStore) Store(name string, value string) error {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+
+	// the name is authenticated so values cannot be swapped between secrets
+	encrypted := s.aead.Seal(nonce, nonce, []byte(value), []byte(name))
+
+	ctx, cancel := context.WithTimeout(context.Background(), mongoTimeout)
+	defer cancel()
+	_, err := s.collection.ReplaceOne(ctx,
+		bson.M{"name": name},
+		&secret{Name: name, Value: encrypted},
+		options.Replace().SetUpsert(true))
+	return err
+}
+
+// Get - returns the decrypted value of the secret
+func (s *SecretStore) Get(name string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), mongoTimeout)
+	defer cancel()
+	var entry secret
+	err := s.collection.FindOne(ctx, bson.M{"name": name}).Decode(&entry)
+	if err == mongo.ErrNoDocuments {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	size := s.aead.NonceSize()
+	if len(entry.Value) < size {
+		return "", errors.New("secret `" + name + "` is corrupted")
+	}
+	value, err := s.aead.Open(nil, entry.Value[:size], entry.Value[size:], []byte(name))
+	if err != nil {
+		return "", errors.New("unable to decrypt secret `" + name + "`")
+	}
+	return string(value), nil
+}
+
+// List - returns the names of all stored secrets
+func (s *SecretStore) List() ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), mongoTimeout)
+	defer cancel()
+	cur, err := s.collection.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"name": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	names := []string{}
+	for cur.Next(ctx) {
+		var entry secret
+		if err := cur.Decode(&entry); err != nil {
+			return nil, err
+		}
+		names = append(names, entry.Name)
+	}
+	return names, cur.Err()
+}
+
+// Delete - removes the secret with the given name
+func (s *SecretStore) Delete(name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), mongoTimeout)
+	defer cancel()
+	res, err := s.collection.DeleteOne(ctx, bson.M{"name": name})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -1,8 +1,13 @@
 package manager
 
 import (
+	"context"
+
+	"github.com/ko1N/dips/internal/persistence/database/model"
 	"github.com/ko1N/dips/internal/persistence/messages"
 	"github.com/ko1N/dips/pkg/dipscl"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"gopkg.in/mgo.v2/bson"
 )
 
 /*
@@ -31,6 +36,56 @@ func updateJobProgress(job *model.Job) {
 }
 */
 
+// updateJobStatus - stores the current status of the job
+func (a *ManagerAPI) updateJobStatus(jobId string, status model.JobStatus) error {
+	oid, err := primitive.ObjectIDFromHex(jobId)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), mongoTimeout)
+	defer cancel()
+	_, err = a.mongo.
+		Collection(colJobs).
+		UpdateByID(ctx, oid, bson.M{"$set": bson.M{"status": status}})
+	return err
+}
+
+// updateStageStatus - stores the current status of a stage of the job
+func (a *ManagerAPI) updateStageStatus(jobId string, stage string, status model.StageStatus) error {
+	oid, err := primitive.ObjectIDFromHex(jobId)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), mongoTimeout)
+	defer cancel()
+	res, err := a.mongo.
+		Collection(colJobs).
+		UpdateOne(ctx, bson.M{"_id": oid, "stages.name": stage}, bson.M{"$set": bson.M{"stages.$.status": status}})
+	if err != nil || res.MatchedCount > 0 {
+		return err
+	}
+	_, err = a.mongo.
+		Collection(colJobs).
+		UpdateByID(ctx, oid, bson.M{"$push": bson.M{"stages": model.JobStage{Name: stage, Status: status}}})
+	return err
+}
+
+func (a *ManagerAPI) handleResult(msg *dipscl.ResultEvent) error {
+	oid, err := primitive.ObjectIDFromHex(msg.JobId)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), mongoTimeout)
+	defer cancel()
+	_, err = a.mongo.
+		Collection(colJobs).
+		UpdateByID(ctx, oid, bson.M{"$set": bson.M{"outputs": msg.Outputs}})
+	return err
+}
+
 func (a *ManagerAPI) handleMessage(msg *dipscl.MessageEvent) error {
 	a.messageHandler.Store(msg.JobId, messages.Message{
 		Type:    uint(msg.Type),
@@ -40,6 +95,13 @@ func (a *ManagerAPI) handleMessage(msg *dipscl.MessageEvent) error {
 }
 
 func (a *ManagerAPI) handleStatus(msg *dipscl.StatusEvent) error {
+	switch msg.Type {
+	case dipscl.JobStatusEvent:
+		return a.updateJobStatus(msg.JobId, msg.JobStatus)
+	case dipscl.StageStatusEvent:
+		return a.updateStageStatus(msg.JobId, msg.Stage, msg.StageStatus)
+	}
+
 	/*
 		// find job
 		job, err := jobs.FindJobByID(msg.JobID)
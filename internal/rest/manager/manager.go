@@ -5,7 +5,9 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/ko1N/dips/internal/persistence/messages"
+	"github.com/ko1N/dips/internal/persistence/secrets"
 	"github.com/ko1N/dips/pkg/dipscl"
+	"github.com/ko1N/dips/pkg/pipeline"
 	"go.mongodb.org/mongo-driver/mongo"
 )
 
@@ -13,6 +15,7 @@ import (
 const mongoTimeout = 5 * time.Second
 const colPipeline = "pipeline"
 const colJobs = "jobs"
+const colRevisions = "pipeline_revisions"
 
 // SuccessResponse - reponse for a successful operation
 type SuccessResponse struct {
@@ -30,6 +33,8 @@ type ManagerAPI struct {
 	dipscl         *dipscl.Client
 	mongo          *mongo.Database
 	messageHandler messages.MessageHandler
+	secretStore    *secrets.SecretStore // nil if no secret key has been configured
+	catalog        *pipeline.ServiceCatalog
 }
 
 // CreateManagerAPI - adds the manager api to a gin engine
@@ -38,18 +43,23 @@ func CreateManagerAPI(
 	dipscl *dipscl.Client,
 	mongo *mongo.Database,
 	messageHandler messages.MessageHandler,
+	secretStore *secrets.SecretStore,
+	catalog *pipeline.ServiceCatalog,
 ) (*ManagerAPI, error) {
 	api := &ManagerAPI{
 		gin,
 		dipscl,
 		mongo,
 		messageHandler,
+		secretStore,
+		catalog,
 	}
 
 	// register event handlers
 	api.dipscl.NewEventHandler().
 		HandleMessage(api.handleMessage).
 		HandleStatus(api.handleStatus).
+		HandleResult(api.handleResult).
 		Run()
 
 	// setup rest routes
@@ -58,10 +68,16 @@ func CreateManagerAPI(
 	r.POST("/manager/pipeline/", api.PipelineCreate)
 	r.GET("/manager/pipeline/all", api.PipelineList)
 	r.GET("/manager/pipeline/details/:pipeline_id", api.PipelineDetails)
+	r.GET("/manager/pipeline/schema", api.PipelineSchema)
 	r.PATCH("/manager/pipeline/:pipeline_id", api.PipelineUpdate)
 	r.DELETE("/manager/pipeline/:pipeline_id", api.PipelineDelete)
 
 	r.POST("/manager/pipeline/execute/:pipeline_id", api.PipelineExecute)
+	r.POST("/manager/pipeline/plan/:pipeline_id", api.PipelinePlan)
+
+	r.POST("/manager/secret/", api.SecretCreate)
+	r.GET("/manager/secret/all", api.SecretList)
+	r.DELETE("/manager/secret/:name", api.SecretDelete)
 
 	r.GET("/manager/job/all", api.JobList) // TODO: add more queries, running, finished, etc
 	r.GET("/manager/job/details/:job_id", api.JobDetails)
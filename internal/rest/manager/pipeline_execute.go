@@ -3,10 +3,12 @@ package manager
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
 	"github.com/ko1N/dips/internal/persistence/database/model"
+	"github.com/ko1N/dips/pkg/pipeline"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"gopkg.in/mgo.v2/bson"
 )
@@ -22,6 +24,13 @@ type PipelineExecuteResponse struct {
 	Job *model.Job `json:"job"`
 }
 
+// PipelineExecuteFailureResponse - response for an execute request with invalid parameters
+type PipelineExecuteFailureResponse struct {
+	Status     string                    `json:"status"`
+	Error      string                    `json:"error"`
+	Parameters []pipeline.ParameterError `json:"parameters"`
+}
+
 // PipelineExecute - executes a pipeline
 // @Summary executes a pipeline
 // @Description This method will execute the pipeline with the given id
@@ -32,7 +41,7 @@ type PipelineExecuteResponse struct {
 // @Param pipeline_id path string true "Pipeline ID"
 // @Param execute_request body PipelineExecuteRequest true "Request Body"
 // @Success 200 {object} PipelineExecuteResponse
-// @Failure 400 {object} FailureResponse
+// @Failure 400 {object} PipelineExecuteFailureResponse
 // @Router /manager/pipeline/execute/{pipeline_id} [post]
 func (a *ManagerAPI) PipelineExecute(c *gin.Context) {
 	// try to find requested pipeline
@@ -58,8 +67,8 @@ func (a *ManagerAPI) PipelineExecute(c *gin.Context) {
 		})
 		return
 	}
-	var pipeline model.Pipeline
-	err := fres.Decode(&pipeline)
+	var pipe model.Pipeline
+	err := fres.Decode(&pipe)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, FailureResponse{
 			Status: "unable to find pipeline with id `" + pipelineId + "`",
@@ -88,12 +97,33 @@ func (a *ManagerAPI) PipelineExecute(c *gin.Context) {
 		return
 	}
 
+	// validate parameters before anything is persisted or dispatched
+	if pipe.Pipeline == nil {
+		c.JSON(http.StatusBadRequest, FailureResponse{
+			Status: "unable to execute pipeline with id `" + pipelineId + "`",
+			Error:  "pipeline has not been parsed",
+		})
+		return
+	}
+	variables, err := pipe.Pipeline.ValidateParameters(request.Parameters)
+	if err != nil {
+		var paramErrs pipeline.ParameterErrors
+		errors.As(err, &paramErrs)
+		c.JSON(http.StatusBadRequest, PipelineExecuteFailureResponse{
+			Status:     "invalid parameters",
+			Error:      err.Error(),
+			Parameters: paramErrs,
+		})
+		return
+	}
+
 	// create the job in the database
 	// input parameters are mapped to variables here
 	job := model.Job{
 		Name:      request.Name,
-		Variables: request.Parameters,
-		Pipeline:  &pipeline,
+		Status:    model.JobQueued,
+		Variables: variables,
+		Pipeline:  &pipe,
 	}
 
 	ires, err := a.mongo.
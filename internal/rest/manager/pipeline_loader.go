@@ -0,0 +1,65 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/ko1N/dips/internal/persistence/database/model"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// storedPipelineLoader - resolves `import` references against the stored pipelines
+// references are either of the form `name` for the latest revision or `name@revision`
+type storedPipelineLoader struct {
+	mongo *mongo.Database
+}
+
+// Load - finds the referenced pipeline in the database and returns its script
+// previous revisions are looked up in the revision history if the current pipeline has a different revision
+func (l *storedPipelineLoader) Load(from string, ref string) (string, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), mongoTimeout)
+	defer cancel()
+
+	idx := strings.LastIndex(ref, "@")
+	if idx < 0 {
+		pipe, err := l.find(ctx, colPipeline, bson.M{"name": ref})
+		if err != nil {
+			return ref, "", err
+		}
+		return pipe.Name + "@" + strconv.Itoa(int(pipe.Revision)), pipe.Script, nil
+	}
+
+	revision, err := strconv.ParseUint(ref[idx+1:], 10, 32)
+	if err != nil {
+		return ref, "", errors.New("invalid revision in pipeline reference `" + ref + "`")
+	}
+	filter := bson.M{"name": ref[:idx], "revision": uint(revision)}
+	pipe, err := l.find(ctx, colPipeline, filter)
+	if err == mongo.ErrNoDocuments {
+		pipe, err = l.find(ctx, colRevisions, filter)
+	}
+	if err != nil {
+		return ref, "", err
+	}
+	return ref, pipe.Script, nil
+}
+
+// find - returns the pipeline with the highest revision matching the filter
+func (l *storedPipelineLoader) find(ctx context.Context, collection string, filter bson.M) (*model.Pipeline, error) {
+	fres := l.mongo.
+		Collection(collection).
+		FindOne(ctx, filter, options.FindOne().SetSort(bson.M{"revision": -1}))
+	if fres.Err() != nil {
+		return nil, fres.Err()
+	}
+	var pipe model.Pipeline
+	err := fres.Decode(&pipe)
+	if err != nil {
+		return nil, err
+	}
+	return &pipe, nil
+}
@@ -0,0 +1,130 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/ko1N/dips/internal/persistence/database/model"
+	"github.com/ko1N/dips/pkg/execution"
+	"github.com/ko1N/dips/pkg/execution/tracking"
+	"github.com/ko1N/dips/pkg/pipeline"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// PipelinePlanRequest - Request Body when planning a pipeline
+type PipelinePlanRequest struct {
+	Parameters map[string]interface{} `json:"parameters"`
+}
+
+// PipelinePlanResponse - Response with the tasks a job of the pipeline would run
+type PipelinePlanResponse struct {
+	Plan *execution.Plan `json:"plan"`
+}
+
+// PipelinePlan - plans a pipeline without executing it
+// @Summary plans a pipeline
+// @Description This method will return the tasks a job of the pipeline with the given id would run, no task is dispatched.
+// @Description Inputs and conditions are evaluated where their values are known, results of tasks and of functions with access to the host like `env` are rendered as `<expression>`.
+// @ID pipeline-plan
+// @Tags pipelines
+// @Accept json
+// @Produce json
+// @Param pipeline_id path string true "Pipeline ID"
+// @Param plan_request body PipelinePlanRequest true "Request Body"
+// @Success 200 {object} PipelinePlanResponse
+// @Failure 400 {object} PipelineExecuteFailureResponse
+// @Router /manager/pipeline/plan/{pipeline_id} [post]
+func (a *ManagerAPI) PipelinePlan(c *gin.Context) {
+	// try to find requested pipeline
+	pipelineId := c.Param("pipeline_id")
+	if pipelineId == "" {
+		c.JSON(http.StatusBadRequest, FailureResponse{
+			Status: "invalid pipeline_id",
+			Error:  "pipeline_id must not be empty",
+		})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), mongoTimeout)
+	defer cancel()
+	oid, _ := primitive.ObjectIDFromHex(pipelineId)
+	fres := a.mongo.
+		Collection(colPipeline).
+		FindOne(ctx, bson.M{"_id": oid})
+	if fres.Err() != nil {
+		c.JSON(http.StatusBadRequest, FailureResponse{
+			Status: "unable to find pipeline with id `" + pipelineId + "`",
+			Error:  fres.Err().Error(),
+		})
+		return
+	}
+	var pipe model.Pipeline
+	err := fres.Decode(&pipe)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailureResponse{
+			Status: "unable to find pipeline with id `" + pipelineId + "`",
+			Error:  err.Error(),
+		})
+		return
+	}
+
+	// try to parse body
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailureResponse{
+			Status: "unable to read body",
+			Error:  err.Error(),
+		})
+		return
+	}
+
+	var request PipelinePlanRequest
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailureResponse{
+			Status: "unable to parse request body",
+			Error:  err.Error(),
+		})
+		return
+	}
+
+	// parameters are validated the same way as for an execution
+	if pipe.Pipeline == nil {
+		c.JSON(http.StatusBadRequest, FailureResponse{
+			Status: "unable to plan pipeline with id `" + pipelineId + "`",
+			Error:  "pipeline has not been parsed",
+		})
+		return
+	}
+	if err := pipe.Pipeline.Compile(); err != nil {
+		c.JSON(http.StatusBadRequest, FailureResponse{
+			Status: "unable to plan pipeline with id `" + pipelineId + "`",
+			Error:  err.Error(),
+		})
+		return
+	}
+	variables, err := pipe.Pipeline.ValidateParameters(request.Parameters)
+	if err != nil {
+		var paramErrs pipeline.ParameterErrors
+		errors.As(err, &paramErrs)
+		c.JSON(http.StatusBadRequest, PipelineExecuteFailureResponse{
+			Status:     "invalid parameters",
+			Error:      err.Error(),
+			Parameters: paramErrs,
+		})
+		return
+	}
+
+	// a failing job is part of the plan, it is returned as its error
+	plan, _ := execution.NewExecutionContext("plan", pipe.Pipeline, tracking.CreateDiscardTracker("plan")).
+		Variables(variables).
+		Plan()
+
+	c.JSON(http.StatusOK, PipelinePlanResponse{
+		Plan: plan,
+	})
+}
@@ -2,6 +2,7 @@ package manager
 
 import (
 	"context"
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -19,6 +20,45 @@ type PipelineCreateResponse struct {
 	Pipeline model.Pipeline `json:"pipeline"`
 }
 
+// PipelineParseFailureResponse - response for a pipeline script that could not be parsed
+type PipelineParseFailureResponse struct {
+	Status      string                `json:"status"`
+	Error       string                `json:"error"`
+	Diagnostics []pipeline.Diagnostic `json:"diagnostics"`
+}
+
+// pipelineParseFailure - responds with all diagnostics the parser reported
+func pipelineParseFailure(c *gin.Context, err error) {
+	var diags pipeline.Diagnostics
+	if !errors.As(err, &diags) {
+		diags = pipeline.Diagnostics{{Severity: pipeline.SeverityError, Message: err.Error()}}
+	}
+	c.JSON(http.StatusBadRequest, PipelineParseFailureResponse{
+		Status:      "unable to parse pipeline",
+		Error:       err.Error(),
+		Diagnostics: diags,
+	})
+}
+
+// parsePipeline - parses the given script and resolves references against the stored pipelines
+func (a *ManagerAPI) parsePipeline(script string) (*pipeline.Pipeline, error) {
+	return pipeline.NewParser().
+		Loader(&storedPipelineLoader{a.mongo}).
+		DisableIncludes("stored pipelines are complete pipelines, use `import` to add their stages").
+		Catalog(a.catalog).
+		Parse("", script)
+}
+
+// unchanged - checks if the script still parses into the same canonical pipeline
+// both scripts are parsed against the current stored pipelines so changed references are detected as well
+func (a *ManagerAPI) unchanged(script string, pi *pipeline.Pipeline) bool {
+	previous, err := a.parsePipeline(script)
+	if err != nil {
+		return false
+	}
+	return pipeline.Equivalent(previous, pi)
+}
+
 // PipelineCreate - creates a pipeline
 // @Summary creates a pipeline
 // @Description This method will create the pipeline sent via the post body
@@ -28,7 +68,7 @@ type PipelineCreateResponse struct {
 // @Produce json
 // @Param pipeline body string true "Pipeline Script"
 // @Success 200 {object} PipelineCreateResponse
-// @Failure 400 {object} FailureResponse
+// @Failure 400 {object} PipelineParseFailureResponse
 // @Router /manager/pipeline/ [post]
 func (a *ManagerAPI) PipelineCreate(c *gin.Context) {
 	body, err := c.GetRawData()
@@ -40,13 +80,10 @@ func (a *ManagerAPI) PipelineCreate(c *gin.Context) {
 		return
 	}
 
-	// pre-validate body
-	pi, err := pipeline.CreateFromBytes(string(body))
+	// pre-validate body and resolve all references
+	pi, err := a.parsePipeline(string(body))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, FailureResponse{
-			Status: "unable to parse pipeline",
-			Error:  err.Error(),
-		})
+		pipelineParseFailure(c, err)
 		return
 	}
 
@@ -136,7 +173,20 @@ func (a *ManagerAPI) PipelineList(c *gin.Context) {
 
 // PipelineDetailsResponse - response with pipeline details
 type PipelineDetailsResponse struct {
-	Pipeline *model.Pipeline `json:"pipeline"`
+	Pipeline   *model.Pipeline      `json:"pipeline"`
+	Parameters []pipeline.Parameter `json:"parameters"`
+}
+
+// newPipelineDetailsResponse - creates the details response including the declared parameters
+func newPipelineDetailsResponse(pipe *model.Pipeline) PipelineDetailsResponse {
+	response := PipelineDetailsResponse{
+		Pipeline:   pipe,
+		Parameters: []pipeline.Parameter{},
+	}
+	if pipe.Pipeline != nil && pipe.Pipeline.Parameters != nil {
+		response.Parameters = pipe.Pipeline.Parameters
+	}
+	return response
 }
 
 // PipelineDetails - find a pipeline by it's id and shows all fields
@@ -172,8 +222,8 @@ func (a *ManagerAPI) PipelineDetails(c *gin.Context) {
 		})
 		return
 	}
-	var pipeline model.Pipeline
-	err := fres.Decode(&pipeline)
+	var pipe model.Pipeline
+	err := fres.Decode(&pipe)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, FailureResponse{
 			Status: "unable to find pipeline with id `" + id + "`",
@@ -182,14 +232,24 @@ func (a *ManagerAPI) PipelineDetails(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, PipelineDetailsResponse{
-		Pipeline: &pipeline,
-	})
+	c.JSON(http.StatusOK, newPipelineDetailsResponse(&pipe))
+}
+
+// PipelineSchema - returns the JSON Schema of pipeline scripts
+// @Summary returns the JSON Schema of pipeline scripts
+// @Description This method will return the JSON Schema all pipeline scripts are validated against, services are restricted to the configured services.
+// @ID pipeline-schema
+// @Tags pipelines
+// @Produce json
+// @Success 200 {object} pipeline.Schema
+// @Router /manager/pipeline/schema [get]
+func (a *ManagerAPI) PipelineSchema(c *gin.Context) {
+	c.JSON(http.StatusOK, pipeline.NewSchema(a.catalog))
 }
 
 // PipelineUpdate - updates the pipeline with the given id
 // @Summary updates the pipeline with the given id
-// @Description This method will update the given pipeline from a provided script
+// @Description This method will update the given pipeline from a provided script, the revision is only increased if the parsed pipeline changed
 // @ID pipeline-update
 // @Tags pipelines
 // @Accept plain
@@ -197,7 +257,7 @@ func (a *ManagerAPI) PipelineDetails(c *gin.Context) {
 // @Param pipeline_id path string true "Pipeline ID"
 // @Param pipeline body string true "Pipeline Script"
 // @Success 200 {object} PipelineDetailsResponse
-// @Failure 400 {object} FailureResponse
+// @Failure 400 {object} PipelineParseFailureResponse
 // @Router /manager/pipeline/{pipeline_id} [patch]
 func (a *ManagerAPI) PipelineUpdate(c *gin.Context) {
 	// read pipeline from db
@@ -243,19 +303,33 @@ func (a *ManagerAPI) PipelineUpdate(c *gin.Context) {
 		return
 	}
 
-	// validate body
-	pi, err := pipeline.CreateFromBytes(string(body))
+	// validate body and resolve all references
+	pi, err := a.parsePipeline(string(body))
 	if err != nil {
-		c.JSON(http.StatusBadRequest, FailureResponse{
-			Status: "unable to parse pipeline",
-			Error:  err.Error(),
-		})
+		pipelineParseFailure(c, err)
 		return
 	}
 
 	if string(pipe.Script) != string(body) {
-		// update pipeline script
-		pipe.Revision = pipe.Revision + 1
+		// update pipeline script, only changes to the canonical form of the pipeline create a new revision
+		// the previous revision is kept so it can still be referenced as `name@revision`
+		if !a.unchanged(pipe.Script, pi) {
+			_, err := a.mongo.
+				Collection(colRevisions).
+				InsertOne(ctx, &model.Pipeline{
+					Revision: pipe.Revision,
+					Name:     pipe.Name,
+					Script:   pipe.Script,
+				})
+			if err != nil {
+				c.JSON(http.StatusBadRequest, FailureResponse{
+					Status: "unable to store previous revision of pipeline",
+					Error:  err.Error(),
+				})
+				return
+			}
+			pipe.Revision = pipe.Revision + 1
+		}
 		pipe.Name = pi.Name
 		pipe.Script = string(body)
 		pipe.Pipeline = pi
@@ -272,9 +346,7 @@ func (a *ManagerAPI) PipelineUpdate(c *gin.Context) {
 		}
 	}
 
-	c.JSON(http.StatusOK, PipelineDetailsResponse{
-		Pipeline: &pipe,
-	})
+	c.JSON(http.StatusOK, newPipelineDetailsResponse(&pipe))
 }
 
 // PipelineDelete - deletes the pipeline with the given id
@@ -0,0 +1,144 @@
+package manager
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SecretCreateRequest - Request to create or replace a secret
+type SecretCreateRequest struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// SecretListResponse - response with the names of all secrets
+type SecretListResponse struct {
+	Secrets []string `json:"secrets"`
+}
+
+// SecretCreate - creates or replaces a secret
+// @Summary creates or replaces a secret
+// @Description This method will encrypt and store the secret sent via the post body, secrets can be referenced in pipelines via `secret("name")`
+// @ID secret-create
+// @Tags secrets
+// @Accept json
+// @Produce json
+// @Param secret body SecretCreateRequest true "Secret"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} FailureResponse
+// @Router /manager/secret/ [post]
+func (a *ManagerAPI) SecretCreate(c *gin.Context) {
+	if a.secretStore == nil {
+		c.JSON(http.StatusBadRequest, FailureResponse{
+			Status: "unable to store secret",
+			Error:  "no secret store configured",
+		})
+		return
+	}
+
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailureResponse{
+			Status: "unable to read body",
+			Error:  err.Error(),
+		})
+		return
+	}
+
+	var request SecretCreateRequest
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailureResponse{
+			Status: "unable to parse request body",
+			Error:  err.Error(),
+		})
+		return
+	}
+	if request.Name == "" {
+		c.JSON(http.StatusBadRequest, FailureResponse{
+			Status: "invalid secret name",
+			Error:  "secret name must not be empty",
+		})
+		return
+	}
+
+	err = a.secretStore.Store(request.Name, request.Value)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailureResponse{
+			Status: "unable to store secret",
+			Error:  err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Status: "secret `" + request.Name + "` stored",
+	})
+}
+
+// SecretList - lists the names of all secrets
+// @Summary lists the names of all secrets
+// @Description This method will return the names of all secrets, the values are never returned
+// @ID secret-list
+// @Tags secrets
+// @Produce json
+// @Success 200 {object} SecretListResponse
+// @Failure 400 {object} FailureResponse
+// @Router /manager/secret/all [get]
+func (a *ManagerAPI) SecretList(c *gin.Context) {
+	if a.secretStore == nil {
+		c.JSON(http.StatusOK, SecretListResponse{
+			Secrets: []string{},
+		})
+		return
+	}
+
+	names, err := a.secretStore.List()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailureResponse{
+			Status: "error fetching secrets",
+			Error:  err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, SecretListResponse{
+		Secrets: names,
+	})
+}
+
+// SecretDelete - deletes a secret
+// @Summary deletes a secret
+// @Description This method will delete the secret with the given name
+// @ID secret-delete
+// @Tags secrets
+// @Produce json
+// @Param name path string true "Secret Name"
+// @Success 200 {object} SuccessResponse
+// @Failure 400 {object} FailureResponse
+// @Router /manager/secret/{name} [delete]
+func (a *ManagerAPI) SecretDelete(c *gin.Context) {
+	name := c.Param("name")
+	if a.secretStore == nil {
+		c.JSON(http.StatusBadRequest, FailureResponse{
+			Status: "unable to delete secret `" + name + "`",
+			Error:  "no secret store configured",
+		})
+		return
+	}
+
+	err := a.secretStore.Delete(name)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, FailureResponse{
+			Status: "unable to delete secret `" + name + "`",
+			Error:  err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, SuccessResponse{
+		Status: "secret `" + name + "` deleted",
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 
 	"github.com/ko1N/dips/internal/amqp"
+	"github.com/ko1N/dips/internal/persistence/database/model"
 )
 
 // The event to be dispatched
@@ -12,6 +13,7 @@ type Event struct {
 	status   *StatusEvent
 	message  *MessageEvent
 	variable *VariableEvent
+	result   *ResultEvent
 }
 
 // the type of the job status update
@@ -20,14 +22,20 @@ type StatusEventType uint
 const (
 	// progress update
 	ProgressEvent StatusEventType = 1
+	// the job changed its status
+	JobStatusEvent StatusEventType = 2
+	// a stage of the job changed its status
+	StageStatusEvent StatusEventType = 3
 )
 
 type StatusEvent struct {
-	JobId    string
-	TaskId   string
-	Type     StatusEventType
-	Progress uint
-	//JobStatus string // TODO: enum
+	JobId       string
+	TaskId      string
+	Type        StatusEventType
+	Progress    uint
+	JobStatus   model.JobStatus
+	Stage       string
+	StageStatus model.StageStatus
 }
 
 // the type of the message
@@ -56,6 +64,12 @@ type VariableEvent struct {
 	Value interface{} `json:"value"`
 }
 
+// the declared outputs of a finished job
+type ResultEvent struct {
+	JobId   string
+	Outputs map[string]interface{}
+}
+
 func (c *Client) NewEvent() *Event {
 	return &Event{
 		client: c,
@@ -77,6 +91,11 @@ func (e *Event) Variable(variable *VariableEvent) *Event {
 	return e
 }
 
+func (e *Event) Result(result *ResultEvent) *Event {
+	e.result = result
+	return e
+}
+
 // Dispatches the event (and never blocks)
 func (e *Event) Dispatch() {
 	if e.status != nil {
@@ -117,6 +136,19 @@ func (e *Event) Dispatch() {
 			Payload: string(request),
 		}
 	}
+
+	if e.result != nil {
+		queue := e.client.amqp.RegisterProducer("dips.event.result")
+
+		request, err := json.Marshal(&e.result)
+		if err != nil {
+			panic("Invalid result event: " + err.Error())
+		}
+
+		queue <- amqp.Message{
+			Payload: string(request),
+		}
+	}
 }
 
 type EventHandler struct {
@@ -124,6 +156,7 @@ type EventHandler struct {
 	statusHandler   func(*StatusEvent) error
 	messageHandler  func(*MessageEvent) error
 	variableHandler func(*VariableEvent) error
+	resultHandler   func(*ResultEvent) error
 }
 
 func (c *Client) NewEventHandler() *EventHandler {
@@ -147,6 +180,11 @@ func (h *EventHandler) HandleVariable(variable func(*VariableEvent) error) *Even
 	return h
 }
 
+func (h *EventHandler) HandleResult(result func(*ResultEvent) error) *EventHandler {
+	h.resultHandler = result
+	return h
+}
+
 // Run - Starts a new goroutine for this event handler
 func (h *EventHandler) Run() {
 	// TODO: graceful shutdown
@@ -191,4 +229,18 @@ func (h *EventHandler) Run() {
 			}
 		}()
 	}
+
+	if h.resultHandler != nil {
+		go func() {
+			queue := h.client.amqp.RegisterConsumer("dips.event.result")
+			for request := range queue {
+				var resultEvent ResultEvent
+				err := json.Unmarshal([]byte(request.Payload), &resultEvent)
+				if err != nil {
+					panic("Invalid result event: " + err.Error())
+				}
+				h.resultHandler(&resultEvent)
+			}
+		}()
+	}
 }
@@ -0,0 +1,106 @@
+package dipscl
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Input - returns the raw value of the input and whether it has been set
+func (t *TaskContext) Input(name string) (interface{}, bool) {
+	value, ok := t.Request.Params[name]
+	return value, ok && value != nil
+}
+
+// StringInput - returns the input as a string, numbers and bools are formatted
+// missing inputs are returned as an empty string
+func (t *TaskContext) StringInput(name string) (string, error) {
+	value, ok := t.Input(name)
+	if !ok {
+		return "", nil
+	}
+	if s, ok := ScalarString(value); ok {
+		return s, nil
+	}
+	return "", fmt.Errorf("input `%s` must be a string", name)
+}
+
+// ScalarString - formats a string, bool or number of an input, numbers are never formatted with an exponent
+func ScalarString(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case bool:
+		return strconv.FormatBool(v), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case int, int64:
+		return fmt.Sprint(v), true
+	}
+	return "", false
+}
+
+// IntInput - returns the input as an int, missing inputs are returned as 0
+func (t *TaskContext) IntInput(name string) (int64, error) {
+	value, ok := t.Input(name)
+	if !ok {
+		return 0, nil
+	}
+	switch v := value.(type) {
+	case int:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case float64:
+		// json numbers are always decoded as floats
+		if v == math.Trunc(v) {
+			return int64(v), nil
+		}
+	case string:
+		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("input `%s` must be an int", name)
+}
+
+// BoolInput - returns the input as a bool, missing inputs are returned as false
+func (t *TaskContext) BoolInput(name string) (bool, error) {
+	value, ok := t.Input(name)
+	if !ok {
+		return false, nil
+	}
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b, nil
+		}
+	}
+	return false, fmt.Errorf("input `%s` must be a bool", name)
+}
+
+// ListInput - returns the input as a list, missing inputs are returned as nil
+func (t *TaskContext) ListInput(name string) ([]interface{}, error) {
+	value, ok := t.Input(name)
+	if !ok {
+		return nil, nil
+	}
+	if l, ok := value.([]interface{}); ok {
+		return l, nil
+	}
+	return nil, fmt.Errorf("input `%s` must be a list", name)
+}
+
+// MapInput - returns the input as a map, missing inputs are returned as nil
+func (t *TaskContext) MapInput(name string) (map[string]interface{}, error) {
+	value, ok := t.Input(name)
+	if !ok {
+		return nil, nil
+	}
+	if m, ok := value.(map[string]interface{}); ok {
+		return m, nil
+	}
+	return nil, fmt.Errorf("input `%s` must be a map", name)
+}
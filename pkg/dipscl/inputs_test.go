@@ -0,0 +1,67 @@
+package dipscl
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestTypedInputs(t *testing.T) {
+	// inputs arrive as json, so all numbers are decoded as floats
+	var request TaskRequest
+	err := json.Unmarshal([]byte(`{"params": {
+		"cmd": "ffmpeg",
+		"height": 720,
+		"crf": "23",
+		"ratio": 1.5,
+		"overwrite": true,
+		"args": ["-vf", "scale=-2:720"],
+		"metadata": {"title": "bunny"},
+		"unset": null
+	}}`), &request)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	task := &TaskContext{Request: &request}
+
+	if v, err := task.StringInput("height"); v != "720" || err != nil {
+		t.Errorf("StringInput(height) = %q, %v", v, err)
+	}
+	if v, err := task.StringInput("ratio"); v != "1.5" || err != nil {
+		t.Errorf("StringInput(ratio) = %q, %v", v, err)
+	}
+	if v, err := task.IntInput("height"); v != 720 || err != nil {
+		t.Errorf("IntInput(height) = %d, %v", v, err)
+	}
+	if v, err := task.IntInput("crf"); v != 23 || err != nil {
+		t.Errorf("IntInput(crf) = %d, %v", v, err)
+	}
+	if v, err := task.BoolInput("overwrite"); !v || err != nil {
+		t.Errorf("BoolInput(overwrite) = %v, %v", v, err)
+	}
+	if v, err := task.ListInput("args"); !reflect.DeepEqual(v, []interface{}{"-vf", "scale=-2:720"}) || err != nil {
+		t.Errorf("ListInput(args) = %v, %v", v, err)
+	}
+	if v, err := task.MapInput("metadata"); !reflect.DeepEqual(v, map[string]interface{}{"title": "bunny"}) || err != nil {
+		t.Errorf("MapInput(metadata) = %v, %v", v, err)
+	}
+
+	// missing and null inputs return the zero value
+	if v, err := task.IntInput("unset"); v != 0 || err != nil {
+		t.Errorf("IntInput(unset) = %d, %v", v, err)
+	}
+	if v, err := task.StringInput("missing"); v != "" || err != nil {
+		t.Errorf("StringInput(missing) = %q, %v", v, err)
+	}
+
+	// inputs of the wrong type are reported
+	if _, err := task.IntInput("ratio"); err == nil {
+		t.Errorf("IntInput(ratio) accepted a fraction")
+	}
+	if _, err := task.StringInput("args"); err == nil {
+		t.Errorf("StringInput(args) accepted a list")
+	}
+	if _, err := task.MapInput("cmd"); err == nil {
+		t.Errorf("MapInput(cmd) accepted a string")
+	}
+}
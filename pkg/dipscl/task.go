@@ -1,6 +1,7 @@
 package dipscl
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"strconv"
@@ -20,21 +21,22 @@ type Task struct {
 	client       *Client
 	service      string
 	id           string
+	ctx          context.Context
 	timeout      time.Duration
 	taskRequests (chan amqp.Message)
 	taskResults  (chan amqp.Message)
 	job          *model.Job
 	name         string
-	params       map[string]string
+	params       map[string]interface{}
 }
 
 // TaskRequest - Request to start a task
 type TaskRequest struct {
-	TaskID  string            `json:"id" bson:"id"`
-	Timeout time.Duration     `json:"timeout" bson:"timeout"`
-	Job     *model.Job        `json:"job" bson:"job"`
-	Name    string            `json:"name" bson:"name"`
-	Params  map[string]string `json:"params" bson:"params"`
+	TaskID  string                 `json:"id" bson:"id"`
+	Timeout time.Duration          `json:"timeout" bson:"timeout"`
+	Job     *model.Job             `json:"job" bson:"job"`
+	Name    string                 `json:"name" bson:"name"`
+	Params  map[string]interface{} `json:"params" bson:"params"` // typed input, use the accessors of TaskContext
 }
 
 // A task that has been dispatched to a worker that awaits a response
@@ -55,6 +57,7 @@ func (client *Client) NewTask(service string) *Task {
 		client:       client,
 		service:      service,
 		id:           taskId,
+		ctx:          context.Background(),
 		timeout:      defaultTaskTimeout,
 		taskRequests: client.amqp.RegisterProducer("dips.worker.task." + service + ".request"),
 		taskResults:  client.amqp.RegisterResponseConsumer("dips.worker.task."+service+".result", taskId),
@@ -67,6 +70,12 @@ func (t *Task) Timeout(timeout time.Duration) *Task {
 	return t
 }
 
+// Context - Sets the context of the task, the task is no longer awaited once the context is done
+func (t *Task) Context(ctx context.Context) *Task {
+	t.ctx = ctx
+	return t
+}
+
 // Job - Sets the job the task belongs to
 func (t *Task) Job(job *model.Job) *Task {
 	t.job = job
@@ -80,7 +89,7 @@ func (t *Task) Name(name string) *Task {
 }
 
 // Parameters - Sets the input parameters of the task
-func (t *Task) Parameters(params map[string]string) *Task {
+func (t *Task) Parameters(params map[string]interface{}) *Task {
 	t.params = params
 	return t
 }
@@ -110,6 +119,18 @@ func (t *Task) Dispatch() *DispatchedTask {
 	}
 }
 
+// ErrTaskTimeout - returned by Await when the task did not finish within its timeout
+var ErrTaskTimeout = errors.New("Timeout reached while executing task")
+
+// TaskError - returned by Await when the worker reported that the task failed
+type TaskError struct {
+	Message string
+}
+
+func (e *TaskError) Error() string {
+	return e.Message
+}
+
 func (t *DispatchedTask) Await() (*TaskResult, error) {
 	// release channel after this function returns
 	defer t.Close()
@@ -124,13 +145,17 @@ func (t *DispatchedTask) Await() (*TaskResult, error) {
 
 			}
 			if tr.Error != nil {
-				return nil, errors.New(*tr.Error)
+				return nil, &TaskError{Message: *tr.Error}
 			}
 			return &tr, nil
 
+		case <-t.task.ctx.Done():
+			// TODO: notify the worker that the task has been cancelled
+			return nil, t.task.ctx.Err()
+
 		default:
 			if now.Add(t.task.timeout).Before(time.Now()) {
-				return nil, errors.New("Timeout reached while executing task")
+				return nil, ErrTaskTimeout
 			}
 			time.Sleep(1 * time.Millisecond)
 			break
@@ -162,7 +187,6 @@ type TaskContext struct {
 	Filesystem  taskfs.FileSystem
 	Environment taskenv.Environment
 
-	// TODO: input variables
 	// TODO: logging function
 	// TODO: status function
 }
@@ -0,0 +1,118 @@
+package execution
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ko1N/dips/pkg/pipeline"
+)
+
+// TaskFailure - the error of the task which caused a stage or job to fail
+type TaskFailure struct {
+	Task  string // name of the failed task
+	Stage string // name of the stage of the failed task, empty for handlers
+	Err   error
+}
+
+// Error - returns the error of the failed task
+func (f *TaskFailure) Error() string {
+	return f.Err.Error()
+}
+
+// Unwrap - returns the error of the failed task
+func (f *TaskFailure) Unwrap() error {
+	return f.Err
+}
+
+// failed - wraps the error of a task, errors of nested tasks keep the task they originated from
+func failed(task *pipeline.Task, stage string, err error) error {
+	var failure *TaskFailure
+	if errors.As(err, &failure) {
+		return err
+	}
+	return &TaskFailure{
+		Task:  task.DisplayName(),
+		Stage: stage,
+		Err:   err,
+	}
+}
+
+// failureVariables - describes the error to the tasks of an `on_failure` or `always` block
+// `failed` tells whether the block runs after a failure,
+// `failure` contains the name and stage of the failed task and its error `message`
+func failureVariables(err error) map[string]interface{} {
+	if err == nil {
+		return map[string]interface{}{
+			"failed": false,
+		}
+	}
+
+	failure := map[string]interface{}{
+		"task":    "",
+		"stage":   "",
+		"message": err.Error(),
+	}
+	var taskFailure *TaskFailure
+	if errors.As(err, &taskFailure) {
+		failure["task"] = taskFailure.Task
+		failure["stage"] = taskFailure.Stage
+	}
+	return map[string]interface{}{
+		"failed":  true,
+		"failure": failure,
+	}
+}
+
+// runCleanup - runs the `on_failure` tasks if err is set and the `always` tasks in any case, like try / finally
+// all tasks of a block run even if one of them fails, their failures are tracked but never replace err
+// a failed `always` task only fails the stage or job if it succeeded so far
+// stage is the name of the stage the blocks belong to, empty for the blocks of the pipeline
+func (e *ExecutionContext) runCleanup(ctx context.Context, stage string, onFailure []pipeline.Task, always []pipeline.Task, stageVariables map[string]interface{}, err error) error {
+	if len(always) == 0 && (err == nil || len(onFailure) == 0) {
+		return err
+	}
+
+	// cleanup still runs once the job has been cancelled or exceeded its deadline,
+	// each task is then only bound by its own timeout
+	if ctx.Err() != nil {
+		ctx = context.Background()
+	}
+
+	what := "pipeline"
+	if stage != "" {
+		what = "stage `" + stage + "`"
+	}
+
+	variables := make(map[string]interface{}, len(stageVariables)+2)
+	for k, v := range stageVariables {
+		variables[k] = v
+	}
+	for k, v := range failureVariables(err) {
+		variables[k] = v
+	}
+
+	if err != nil && len(onFailure) > 0 {
+		e.Tracker.Info("------ Running on_failure of " + what)
+		for i := range onFailure {
+			cerr := e.runTask(ctx, &onFailure[i], variables)
+			if cerr != nil {
+				e.Tracker.Error("on_failure task of "+what+" failed", "name", onFailure[i].Name, "error", cerr)
+			}
+		}
+	}
+
+	if len(always) > 0 {
+		e.Tracker.Info("------ Running always of " + what)
+		for i := range always {
+			cerr := e.runTask(ctx, &always[i], variables)
+			if cerr != nil {
+				e.Tracker.Error("always task of "+what+" failed", "name", always[i].Name, "error", cerr)
+				if err == nil {
+					err = failed(&always[i], stage, cerr)
+				}
+			}
+		}
+	}
+
+	return err
+}
@@ -1,37 +1,82 @@
 package execution
 
 import (
+	"context"
 	"errors"
-	"regexp"
+	"fmt"
+	"sort"
 	"strconv"
-	"strings"
+	"sync"
+	"time"
 
-	"github.com/d5/tengo/v2"
+	"github.com/ko1N/dips/internal/persistence/database/model"
 	"github.com/ko1N/dips/pkg/execution/tracking"
 	"github.com/ko1N/dips/pkg/pipeline"
 )
 
+// defaultMaxParallel - the amount of tasks of a parallel stage that are dispatched at once
+const defaultMaxParallel = 4
+
+// defaultMaxDepth - the amount of sub-pipelines which can be nested into each other
+const defaultMaxDepth = 8
+
+// defaultRetries - the amount of retries of a task of a service which does not declare `retries`
+const defaultRetries = 3
+
+// defaultMaxIterations - the amount of times a stage with `until` is run if it does not set `max_iterations`
+const defaultMaxIterations = 10
+
+// ErrJobTimeout - returned by Run when the job did not finish within the timeout of the pipeline
+var ErrJobTimeout = errors.New("job exceeded its timeout")
+
+// ErrMaxIterations - returned when the `until` condition of a stage is still false after its last iteration
+var ErrMaxIterations = errors.New("stage exceeded its iterations")
+
+// TaskHandlerFunc - dispatches a task with the rendered input
+// the input keeps the types of the pipeline, strings in nested maps and lists are rendered as well
+// the context is cancelled when the task is no longer awaited
+type TaskHandlerFunc func(ctx context.Context, task *pipeline.Task, input map[string]interface{}) (*ExecutionResult, error)
+
 // ExecutionContext - context for a execution
 type ExecutionContext struct {
 	JobID       string
 	Pipeline    *pipeline.Pipeline
 	Tracker     tracking.JobTracker
 	variables   map[string]interface{}
-	taskHandler func(*pipeline.Task, map[string]string) (*ExecutionResult, error)
+	taskHandler TaskHandlerFunc
+	maxParallel int
+	maxDepth    int
+	retries     int                           // retries of tasks of services which do not declare `retries`
+	depth       int                           // nesting level of sub-pipelines, 0 for the job itself
+	pipelines   map[string]*pipeline.Pipeline // sub-pipelines of the root pipeline
+	secrets     SecretResolverFunc
+	limits      pipeline.ExpressionLimits
+	lock        sync.Mutex // guards variables, notified and taskID while tasks run in parallel
+	taskID      uint
+	notified    map[string]bool // handlers which have been notified since they last ran
+	outputs     map[string]interface{}
+	plan        *Plan // set while the job is planned, tasks are added to the plan instead of being dispatched
 }
 
 type ExecutionResult struct {
-	Success bool                   `json:"success" bson:"success"`
-	Error   *string                `json:"error" bson:"error"`
-	Output  map[string]interface{} `json:"output" bson:"output"`
+	Success  bool                   `json:"success" bson:"success"`
+	Error    *string                `json:"error" bson:"error"`
+	Output   map[string]interface{} `json:"output" bson:"output"`
+	Attempts int                    `json:"attempts" bson:"attempts"`
 }
 
-func NewExecutionContext(jobID string, pipeline *pipeline.Pipeline, tracker tracking.JobTracker) *ExecutionContext {
+func NewExecutionContext(jobID string, pi *pipeline.Pipeline, tracker tracking.JobTracker) *ExecutionContext {
 	return &ExecutionContext{
-		JobID:     jobID,
-		Pipeline:  pipeline,
-		Tracker:   tracker,
-		variables: make(map[string]interface{}),
+		JobID:       jobID,
+		Pipeline:    pi,
+		Tracker:     tracker,
+		variables:   make(map[string]interface{}),
+		maxParallel: defaultMaxParallel,
+		maxDepth:    defaultMaxDepth,
+		retries:     defaultRetries,
+		pipelines:   pi.Pipelines,
+		limits:      pipeline.DefaultExpressionLimits,
+		notified:    make(map[string]bool),
 	}
 }
 
@@ -43,147 +88,516 @@ func (e *ExecutionContext) Variables(variables map[string]interface{}) *Executio
 }
 
 // Handler - Sets the handler for this worker
-func (e *ExecutionContext) TaskHandler(handler func(*pipeline.Task, map[string]string) (*ExecutionResult, error)) *ExecutionContext {
+func (e *ExecutionContext) TaskHandler(handler TaskHandlerFunc) *ExecutionContext {
 	// TODO: multiple handlers
 	e.taskHandler = handler
 	return e
 }
 
-// Run - runs the execution
+// MaxParallel - Sets the amount of tasks of a parallel stage that are dispatched at once
+// if the stage does not specify `max_parallel` itself
+func (e *ExecutionContext) MaxParallel(maxParallel int) *ExecutionContext {
+	if maxParallel > 0 {
+		e.maxParallel = maxParallel
+	}
+	return e
+}
+
+// MaxDepth - Sets the amount of sub-pipelines which can be nested into each other
+func (e *ExecutionContext) MaxDepth(maxDepth int) *ExecutionContext {
+	if maxDepth > 0 {
+		e.maxDepth = maxDepth
+	}
+	return e
+}
+
+// DefaultRetries - Sets the amount of retries of tasks of services which do not declare `retries` themselves
+// tasks running a sub-pipeline and local tasks are never retried unless they declare it
+func (e *ExecutionContext) DefaultRetries(retries int) *ExecutionContext {
+	if retries >= 0 {
+		e.retries = retries
+	}
+	return e
+}
+
+// ExpressionLimits - Sets the limits of every evaluation of an expression
+func (e *ExecutionContext) ExpressionLimits(limits pipeline.ExpressionLimits) *ExecutionContext {
+	e.limits = limits
+	return e
+}
+
+// Run - runs the execution and tracks the resulting job status
 func (e *ExecutionContext) Run() error {
 	e.Tracker.Info("------ Starting Pipeline: " + e.JobID)
 	defer e.Tracker.Info("------ Finished Pipeline: " + e.JobID)
 
-	// TODO: add CreateExecutionContext
-	// TODO: move context into seperate file
-	// TODO: decouple this function into ExecutionContext
-
-	expression := regexp.MustCompile(`{{.*?}}`)
-
-	taskID := uint(1)
-	for _, stage := range e.Pipeline.Stages {
-		e.Tracker.Info("------ Performing Stage: " + stage.Name)
-
-		// execute tasks in pipeline
-		for _, task := range stage.Tasks {
-			e.Tracker.Info("--- Executing Task " + strconv.Itoa(int(taskID)) + ": " + task.Service + " (" + task.Name + ")")
-
-			// TODO: put this logic in seperate objects
-			// check "when" condition
-			if task.When.Script != "" {
-				res, err := task.When.Evaluate(e.variables)
-				if err != nil {
-					e.Tracker.Error("unable to compile expression", err)
-					return err
-				}
-				if res != "true" {
-					e.Tracker.Info("`when` condition not met, skipping task")
-					taskID++
-					continue
-				}
-			}
+	e.Tracker.Status(model.JobRunning)
+	err := e.run(context.Background())
+	switch {
+	case err == nil:
+		e.Tracker.Result(e.outputs)
+		e.Tracker.Status(model.JobSucceeded)
+	case errors.Is(err, ErrJobTimeout):
+		e.Tracker.Status(model.JobTimedOut)
+	default:
+		e.Tracker.Status(model.JobFailed)
+	}
+	return err
+}
 
-			// dispatch task
-			if e.taskHandler != nil {
-				// TODO: put this logic in seperate objects
-				input := make(map[string]string)
-				for key, value := range task.Parameters {
-					var err error
-					input[key] = string(expression.ReplaceAllFunc([]byte(value.(string)), func(m []byte) []byte {
-						t := strings.TrimSpace(string(m[2 : len(m)-2]))
-						var v string
-						v, err = (&pipeline.Expression{Script: string(t)}).Evaluate(e.variables)
-						return []byte(v)
-					}))
-					if err != nil {
-						e.Tracker.Error("error parsing task input", "error", err)
-						return err
-					}
-				}
-
-				e.Tracker.Info("dispatching task", "input", input)
-				result, err := (e.taskHandler)(&task, input)
-				if err != nil {
-					e.Tracker.Error("task execution failed", "error", err)
-					return err
-				}
-
-				// convert result into tengo objects and store it
-				if task.Register != "" {
-					var v tengo.Object
-					var err error
-					if result.Error == nil {
-						v, err = tengo.FromInterface(map[string]interface{}{
-							"success": result.Success,
-							"output":  result.Output,
-						})
-					} else {
-						v, err = tengo.FromInterface(map[string]interface{}{
-							"success": result.Success,
-							"error":   result.Error,
-							"output":  result.Output,
-						})
-					}
-					if err != nil {
-						e.variables[task.Register] = &tengo.ObjectPtr{}
-					} else {
-						e.variables[task.Register] = v
-					}
-				}
-
-				// TODO: duistingish between service error and actual execution error
-				if !task.IgnoreErrors && err != nil {
-					e.Tracker.Error("aborting pipeline execution", "error", errors.New("task failed to exit properly ("+err.Error()+")"))
-					return nil
-				}
-			}
+// run - runs all stages and handlers until the job is done or its deadline is exceeded
+func (e *ExecutionContext) run(ctx context.Context) error {
+	// variables of the job take precedence over the pipeline defaults
+	err := e.declareDefaults(ctx, e.Pipeline.Parameters, e.Pipeline.Variables)
+	if err != nil {
+		trackFailure(e.Tracker, "unable to evaluate pipeline variables", err)
+		return err
+	}
+
+	// exceeding the deadline stops dispatching and cancels all running tasks
+	if e.Pipeline.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(e.Pipeline.Timeout))
+		defer cancel()
+	}
+
+	e.taskID = 1
+	err = e.runStages(ctx)
+	e.planStage("", "")
+	err = e.runCleanup(ctx, "", e.Pipeline.OnFailure, e.Pipeline.Always, nil, err)
+	if err != nil {
+		return e.deadline(ctx, err)
+	}
 
-			// TODO: new func + throw error if command was not found!
-			/*
-				for _, cmd := range task.Command {
-					for _, ext := range e.Engine.Extensions {
-						if ext.Command() == cmd.Name {
-							for _, rawLine := range cmd.Lines {
-								e.Tracker.Status("$ " + rawLine)
-
-								// TODO: put this logic in seperate objects
-								line := string(expression.ReplaceAllFunc([]byte(rawLine), func(m []byte) []byte {
-									t := strings.TrimSpace(string(m[2 : len(m)-2]))
-									v, err := (&Expression{Script: string(t)}).Evaluate(e.Variables)
-									if err != nil {
-										// TODO:
-									}
-									return []byte(v)
-								}))
-
-								e.Tracker.StdIn(line)
-
-								result, err := ext.Execute(e, line)
-								if err != nil {
-									e.Tracker.Error("task execution failed", "error", err)
-									return err
-								}
-
-								if !task.IgnoreErrors && result.ExitCode != 0 {
-									e.Tracker.Error("aborting pipeline execution", errors.New("task failed to exit properly (exitcode "+strconv.Itoa(result.ExitCode)+")"))
-									return nil
-								}
-
-								// convert result into tengo objects and store it
-								if task.Register != "" {
-									e.Variables[task.Register] = result.ToScriptObject()
-								}
-							}
-						}
-					}
-				}
-			*/
-
-			// if this task doesnt support tracking we just increase it to 100%
-			e.Tracker.Progress(100)
-			taskID++
+	// outputs of a planned job depend on the results of its tasks
+	if e.plan != nil {
+		return nil
+	}
+	return e.evaluateOutputs(ctx)
+}
+
+// runStages - runs all stages and the handlers notified by them
+func (e *ExecutionContext) runStages(ctx context.Context) error {
+	for i := range e.Pipeline.Stages {
+		err := e.runStage(ctx, &e.Pipeline.Stages[i])
+		if err != nil {
+			return err
 		}
 	}
+	e.planStage("", "")
+	return e.runHandlers(ctx, nil, "")
+}
 
+// evaluateOutputs - evaluates the declared outputs of the pipeline over all job variables and registered results
+func (e *ExecutionContext) evaluateOutputs(ctx context.Context) error {
+	variables := e.scope()
+	outputs := make(map[string]interface{}, len(e.Pipeline.Outputs))
+	for i := range e.Pipeline.Outputs {
+		output := &e.Pipeline.Outputs[i]
+		value, err := e.value(ctx, nil, &output.Value, variables)
+		if err != nil {
+			trackFailure(e.Tracker, "unable to evaluate output `"+output.Name+"`", err)
+			return fmt.Errorf("unable to evaluate output `%s`: %w", output.Name, err)
+		}
+		outputs[output.Name] = value
+	}
+	e.outputs = outputs
 	return nil
 }
+
+// Outputs - returns the declared outputs of the pipeline after the execution succeeded
+func (e *ExecutionContext) Outputs() map[string]interface{} {
+	return e.outputs
+}
+
+// deadline - replaces the error with ErrJobTimeout if the job exceeded its deadline
+func (e *ExecutionContext) deadline(ctx context.Context, err error) error {
+	if ctx.Err() != context.DeadlineExceeded {
+		return err
+	}
+	e.Tracker.Error("job exceeded its timeout", "timeout", e.Pipeline.Timeout)
+	return ErrJobTimeout
+}
+
+// runStage - executes all tasks in the stage
+func (e *ExecutionContext) runStage(ctx context.Context, stage *pipeline.Stage) error {
+	name := stage.DisplayName()
+	stageVariables := withMatrix(nil, stage.Matrix)
+
+	// the condition is evaluated once before any variable of the stage is declared
+	reason := ""
+	if stage.When.Script != "" {
+		res, err := e.evaluate(ctx, nil, &stage.When, e.scope(stageVariables))
+		switch {
+		case err == errUnknownValue:
+			reason = "stage `" + name + "` only runs if its `when` condition `" + stage.When.Script + "` is met"
+		case err != nil:
+			trackFailure(e.Tracker, "unable to evaluate `when` condition of stage `"+name+"`", err)
+			e.stageStatus(name, model.StageFailed)
+			return err
+		case res != "true":
+			e.Tracker.Info("`when` condition not met, skipping stage `" + name + "`")
+			e.stageStatus(name, model.StageSkipped)
+			e.planStage(name, "")
+			e.planSkippedStage(stage, "`when` condition `"+stage.When.Script+"` of stage `"+name+"` is not met")
+			return nil
+		}
+	}
+	e.planStage(name, reason)
+
+	e.Tracker.Info("------ Performing Stage: " + name)
+	e.stageStatus(name, model.StageRunning)
+
+	// stage variables are only visible within this stage
+	declared, err := e.declare(ctx, nil, stage.Variables, stageVariables)
+	if err != nil {
+		trackFailure(e.Tracker, "unable to evaluate stage variables", err)
+		e.stageStatus(name, model.StageFailed)
+		return err
+	}
+	for k, v := range declared {
+		stageVariables[k] = v
+	}
+
+	err = e.runIterations(ctx, stage, name, stageVariables)
+	if err == nil && stage.FlushHandlers {
+		err = e.runHandlers(ctx, stageVariables, name)
+	}
+	err = e.runCleanup(ctx, name, stage.OnFailure, stage.Always, stageVariables, err)
+	if err != nil {
+		e.stageStatus(name, model.StageFailed)
+	} else {
+		e.stageStatus(name, model.StageSucceeded)
+	}
+	return err
+}
+
+// runIterations - runs the tasks of the stage once or until its `until` condition is true
+// every iteration has access to its number as `iteration`, starting at 1
+func (e *ExecutionContext) runIterations(ctx context.Context, stage *pipeline.Stage, name string, stageVariables map[string]interface{}) error {
+	if stage.Until.Script == "" {
+		return e.runGraph(ctx, stage, stageVariables)
+	}
+
+	// planned jobs only plan the first iteration, the condition depends on the results of the tasks
+	if e.plan != nil {
+		stageVariables["iteration"] = 1
+		return e.runGraph(ctx, stage, stageVariables)
+	}
+
+	maxIterations := defaultMaxIterations
+	if stage.MaxIterations > 0 {
+		maxIterations = stage.MaxIterations
+	}
+	for iteration := 1; ; iteration++ {
+		stageVariables["iteration"] = iteration
+		if err := e.runGraph(ctx, stage, stageVariables); err != nil {
+			return err
+		}
+
+		res, err := e.evaluate(ctx, nil, &stage.Until, e.scope(stageVariables))
+		if err != nil {
+			trackFailure(e.Tracker, "unable to evaluate `until` condition of stage `"+name+"`", err)
+			return err
+		}
+		if res == "true" {
+			return nil
+		}
+		if iteration >= maxIterations {
+			err := fmt.Errorf("%w: `until` condition of stage `%s` not met after %d iterations", ErrMaxIterations, name, iteration)
+			e.Tracker.Error(err.Error())
+			return err
+		}
+
+		delay := time.Duration(stage.Delay)
+		e.Tracker.Info("`until` condition not met, repeating stage `"+name+"`", "iteration", iteration, "delay", delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// stageStatus - tracks the status of a stage of the job, stages of sub-pipelines are only logged
+func (e *ExecutionContext) stageStatus(name string, status model.StageStatus) {
+	if e.depth == 0 {
+		e.Tracker.StageStatus(name, status)
+	}
+}
+
+// runHandlers - runs all notified handlers once in the order they have been declared
+// stage is the name of the stage flushing the handlers, empty at the end of the job
+func (e *ExecutionContext) runHandlers(ctx context.Context, stageVariables map[string]interface{}, stage string) error {
+	if len(e.notified) == 0 {
+		return nil
+	}
+
+	e.Tracker.Info("------ Running Handlers")
+	for i := range e.Pipeline.Handlers {
+		handler := &e.Pipeline.Handlers[i]
+		if !e.notified[handler.Name] {
+			continue
+		}
+
+		// handlers are allowed to notify handlers declared after them
+		delete(e.notified, handler.Name)
+		err := e.runTask(ctx, handler, stageVariables)
+		if err != nil {
+			return failed(handler, stage, err)
+		}
+	}
+
+	return nil
+}
+
+// runTask - runs the task once or for every item of its loop
+func (e *ExecutionContext) runTask(ctx context.Context, task *pipeline.Task, stageVariables map[string]interface{}) error {
+	e.lock.Lock()
+	taskID := e.taskID
+	e.taskID++
+	e.lock.Unlock()
+	service := task.Service
+	if task.Pipeline != "" {
+		service = "pipeline " + task.Pipeline
+	} else if task.Local != "" {
+		service = string(task.Local)
+	}
+	e.Tracker.Info("--- Executing Task " + strconv.Itoa(int(taskID)) + ": " + service + " (" + task.DisplayName() + ")")
+
+	// the combination of the task is merged into the combination of its stage
+	stageVariables = withMatrix(stageVariables, task.Matrix)
+
+	// task variables are only visible within this task
+	taskVariables, err := e.declare(ctx, task, task.Variables, stageVariables)
+	if err != nil {
+		trackFailure(e.Tracker, "unable to evaluate task variables", err)
+		return err
+	}
+
+	if task.Loop.Script != "" || task.Items != nil {
+		return e.runLoop(ctx, task, taskID, stageVariables, taskVariables)
+	}
+
+	tracker := e.Tracker.Task(strconv.Itoa(int(taskID)))
+	result, err := e.execute(ctx, task, tracker, e.scope(stageVariables, taskVariables))
+	if err != nil {
+		return err
+	}
+	if result == nil {
+		return nil
+	}
+
+	e.register(task, result.toMap())
+	if result.Success {
+		e.notify(task)
+	}
+
+	// if this task doesnt support tracking we just increase it to 100%
+	tracker.Progress(100)
+	return nil
+}
+
+// runLoop - runs the task for every item, each iteration is tracked as a sub-task
+// the results of all iterations are registered as an array
+func (e *ExecutionContext) runLoop(ctx context.Context, task *pipeline.Task, taskID uint, stageVariables map[string]interface{}, taskVariables map[string]interface{}) error {
+	items, indices, err := e.loopItems(ctx, task, e.scope(stageVariables, taskVariables))
+	if err != nil {
+		trackFailure(e.Tracker, "unable to evaluate loop", err)
+		return err
+	}
+
+	e.Tracker.Info("looping over " + strconv.Itoa(len(items)) + " items")
+	results := make([]interface{}, 0, len(items))
+	success := false
+	for i, item := range items {
+		tracker := e.Tracker.Task(strconv.Itoa(int(taskID)) + "." + strconv.Itoa(i))
+		tracker.Info("--- Executing Iteration " + strconv.Itoa(i+1) + "/" + strconv.Itoa(len(items)))
+
+		loopVariables := map[string]interface{}{
+			"item":  item,
+			"index": indices[i],
+		}
+		result, err := e.execute(ctx, task, tracker, e.scope(stageVariables, taskVariables, loopVariables))
+		if err != nil {
+			return err
+		}
+
+		var registered map[string]interface{}
+		if result != nil {
+			registered = result.toMap()
+			success = success || result.Success
+			tracker.Progress(100)
+		} else {
+			registered = map[string]interface{}{
+				"skipped": true,
+			}
+		}
+		registered["item"] = item
+		registered["index"] = indices[i]
+		results = append(results, registered)
+	}
+
+	e.register(task, results)
+	if success {
+		e.notify(task)
+	}
+
+	e.Tracker.Progress(100)
+	return nil
+}
+
+// loopItems - returns the items of the loop and their index (the position in an array or the key of a map)
+func (e *ExecutionContext) loopItems(ctx context.Context, task *pipeline.Task, variables map[string]interface{}) ([]interface{}, []interface{}, error) {
+	value := interface{}(task.Items)
+	if task.Items == nil {
+		var err error
+		value, err = e.value(ctx, task, &task.Loop, variables)
+		if err == errUnknownValue {
+			// planned jobs plan a loop over the results of tasks once
+			return []interface{}{unknown("item")}, []interface{}{unknown("index")}, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var items, indices []interface{}
+	switch v := value.(type) {
+	case []interface{}:
+		for i, item := range v {
+			items = append(items, item)
+			indices = append(indices, i)
+		}
+
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			items = append(items, v[k])
+			indices = append(indices, k)
+		}
+
+	default:
+		return nil, nil, errors.New("loop must evaluate to an array or a map")
+	}
+
+	return items, indices, nil
+}
+
+// execute - evaluates the `when` condition of the task and dispatches it
+// the result is nil if the task has been skipped
+func (e *ExecutionContext) execute(ctx context.Context, task *pipeline.Task, tracker tracking.JobTracker, variables map[string]interface{}) (*ExecutionResult, error) {
+	// TODO: put this logic in seperate objects
+	// check "when" condition
+	reason := ""
+	if task.When.Script != "" {
+		res, err := e.evaluate(ctx, task, &task.When, variables)
+		switch {
+		case err == errUnknownValue:
+			reason = "only runs if its `when` condition `" + task.When.Script + "` is met"
+		case err != nil:
+			trackFailure(tracker, "unable to evaluate `when` condition", err)
+			return nil, err
+		case res != "true":
+			tracker.Info("`when` condition not met, skipping task")
+			e.planSkipped(task, &tracker, "`when` condition `"+task.When.Script+"` is not met")
+			return nil, nil
+		}
+	}
+
+	// planned jobs never dispatch a task
+	if e.plan != nil {
+		return e.planTask(ctx, task, tracker, variables, reason)
+	}
+
+	// local tasks never reach the task handler
+	if task.Local != "" {
+		result, err := e.runLocal(ctx, task, tracker, variables)
+		if err != nil {
+			return e.ignoreError(ctx, task, tracker, err, 1)
+		}
+		return result, nil
+	}
+
+	// dispatch task
+	if e.taskHandler == nil && task.Pipeline == "" {
+		return &ExecutionResult{Success: true}, nil
+	}
+
+	input := make(map[string]interface{})
+	inputVariables := e.withSecrets(variables, tracker)
+	for key, value := range task.Parameters {
+		var err error
+		input[key], err = e.renderValue(ctx, task, task.Templates, value, inputVariables)
+		if err != nil {
+			trackFailure(tracker, "unable to render task input `"+key+"`", err)
+			return nil, err
+		}
+	}
+
+	return e.dispatch(ctx, task, tracker, input, variables)
+}
+
+// withMatrix - returns a copy of the variables in which the combination is merged into `matrix`
+func withMatrix(variables map[string]interface{}, matrix pipeline.Matrix) map[string]interface{} {
+	result := make(map[string]interface{}, len(variables)+1)
+	for k, v := range variables {
+		result[k] = v
+	}
+	if len(matrix) == 0 {
+		return result
+	}
+
+	combination := make(map[string]interface{}, len(matrix))
+	if outer, ok := variables["matrix"].(map[string]interface{}); ok {
+		for k, v := range outer {
+			combination[k] = v
+		}
+	}
+	for k, v := range matrix {
+		combination[k] = v
+	}
+	result["matrix"] = combination
+	return result
+}
+
+// register - stores the result of the task in the job variables
+func (e *ExecutionContext) register(task *pipeline.Task, value interface{}) {
+	if task.Register == "" {
+		return
+	}
+	// the results of planned tasks are only known once the job runs, local tasks are evaluated
+	if e.plan != nil && task.Local == "" {
+		value = unknown(task.Register)
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.variables[task.Register] = value
+}
+
+// notify - marks all handlers of the task as notified
+func (e *ExecutionContext) notify(task *pipeline.Task) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	for _, name := range task.Notify {
+		e.Tracker.Info("notifying handler `" + name + "`")
+		e.notified[name] = true
+	}
+}
+
+// toMap - converts the result into the value that is registered for a task
+func (r *ExecutionResult) toMap() map[string]interface{} {
+	result := map[string]interface{}{
+		"success":  r.Success,
+		"output":   r.Output,
+		"attempts": r.Attempts,
+	}
+	if r.Error != nil {
+		result["error"] = *r.Error
+	}
+	return result
+}
@@ -0,0 +1,360 @@
+package execution
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/ko1N/dips/pkg/execution/tracking"
+	"github.com/ko1N/dips/pkg/pipeline"
+)
+
+// run - parses the pipeline and runs it with the given task handler
+func run(t *testing.T, script string, handler TaskHandlerFunc) error {
+	t.Helper()
+
+	pi, err := pipeline.CreateFromBytes(script)
+	if err != nil {
+		t.Fatalf("unable to parse pipeline: %s", err)
+	}
+	return NewExecutionContext("test", pi, tracking.CreateJobTracker(log.New(), nil, "test")).
+		TaskHandler(handler).
+		Run()
+}
+
+// runScript - runs the pipeline and returns the `cmd` input of all dispatched tasks in order,
+// or the name of tasks without one. tasks with a `fail` input report an unsuccessful result
+func runScript(t *testing.T, script string) []string {
+	t.Helper()
+
+	var mu sync.Mutex
+	var dispatched []string
+	err := run(t, script, func(ctx context.Context, task *pipeline.Task, input map[string]interface{}) (*ExecutionResult, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if cmd, ok := input["cmd"].(string); ok {
+			dispatched = append(dispatched, cmd)
+		} else {
+			dispatched = append(dispatched, task.Name)
+		}
+		_, failed := input["fail"]
+		return &ExecutionResult{Success: !failed}, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	return dispatched
+}
+
+func TestHandlersRunOnceInDeclarationOrder(t *testing.T) {
+	dispatched := runScript(t, `---
+stages:
+- stage: first
+  tasks:
+  - name: a
+    service: shell
+    notify: [second handler, first handler]
+  - name: b
+    service: shell
+    notify: second handler
+- stage: second
+  tasks:
+  - name: c
+    service: shell
+handlers:
+- name: first handler
+  service: shell
+- name: second handler
+  service: shell
+- name: unused handler
+  service: shell
+`)
+
+	expects := []string{"a", "b", "c", "first handler", "second handler"}
+	if !reflect.DeepEqual(dispatched, expects) {
+		t.Errorf("dispatched %v, expected %v", dispatched, expects)
+	}
+}
+
+func TestFlushHandlersAtEndOfStage(t *testing.T) {
+	dispatched := runScript(t, `---
+stages:
+- stage: first
+  flush_handlers: true
+  tasks:
+  - name: a
+    service: shell
+    notify: reload
+- stage: second
+  tasks:
+  - name: b
+    service: shell
+    notify: reload
+handlers:
+- name: reload
+  service: shell
+`)
+
+	// the handler runs again after being notified by a later stage
+	expects := []string{"a", "reload", "b", "reload"}
+	if !reflect.DeepEqual(dispatched, expects) {
+		t.Errorf("dispatched %v, expected %v", dispatched, expects)
+	}
+}
+
+func TestHandlerNotifications(t *testing.T) {
+	dispatched := runScript(t, `---
+stages:
+- stage: s
+  tasks:
+  - name: unsuccessful
+    service:
+      name: shell
+      fail: "yes"
+    notify: skipped
+  - name: successful
+    service: shell
+    notify: chained
+handlers:
+- name: chained
+  service: shell
+  notify: [skipped, last]
+- name: skipped
+  service: shell
+- name: last
+  service: shell
+`)
+
+	// unsuccessful tasks do not notify and handlers may notify handlers declared after them
+	expects := []string{"unsuccessful", "successful", "chained", "skipped", "last"}
+	if !reflect.DeepEqual(dispatched, expects) {
+		t.Errorf("dispatched %v, expected %v", dispatched, expects)
+	}
+}
+
+func TestLoops(t *testing.T) {
+	dispatched := runScript(t, `---
+stages:
+- stage: s
+  tasks:
+  - name: encode
+    service:
+      name: shell
+      cmd: "encode {{ index }}: {{ item }}"
+    with_items: [720, 480, 360]
+    when: item != 480
+    register: encodes
+  - name: upload
+    service:
+      name: shell
+      cmd: "upload {{ index }}: {{ item }}"
+    loop: "{{ {mp4: 2, hls: 1} }}"
+  - name: report
+    service:
+      name: shell
+      cmd: "report {{ item.index }}: {{ item.item }} {{ item.success }}"
+    loop: encodes
+    when: is_undefined(item.skipped)
+`)
+
+	// maps are iterated in the order of their keys, skipped iterations are registered as well
+	expects := []string{
+		"encode 0: 720",
+		"encode 2: 360",
+		"upload hls: 1",
+		"upload mp4: 2",
+		"report 0: 720 true",
+		"report 2: 360 true",
+	}
+	if !reflect.DeepEqual(dispatched, expects) {
+		t.Errorf("dispatched %v, expected %v", dispatched, expects)
+	}
+}
+
+func TestParallelStage(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	running, maxRunning := 0, 0
+	err := run(t, `---
+stages:
+- stage: s
+  parallel: true
+  max_parallel: 2
+  tasks:
+  - name: a
+    service: shell
+  - name: b
+    service: shell
+  - name: c
+    service: shell
+  - name: d
+    service: shell
+    depends_on: [a, b, c]
+`, func(ctx context.Context, task *pipeline.Task, input map[string]interface{}) (*ExecutionResult, error) {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		events = append(events, "start "+task.Name)
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		events = append(events, "finish "+task.Name)
+		mu.Unlock()
+		return &ExecutionResult{Success: true}, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if maxRunning != 2 {
+		t.Errorf("%d tasks ran at once, expected max_parallel of 2", maxRunning)
+	}
+	if len(events) != 8 || events[6] != "start d" {
+		t.Errorf("d started before all of its dependencies finished: %v", events)
+	}
+}
+
+var errFailed = errors.New("task failed")
+
+func TestFailurePolicies(t *testing.T) {
+	script := `---
+stages:
+- stage: s
+  failure_policy: %s
+  tasks:
+  - name: a
+    service: shell
+    retries: 0
+  - name: b
+    service: shell
+  - name: c
+    service: shell
+    depends_on: a
+`
+	// a fails, b does not depend on it while c does
+	policies := map[string][]string{
+		"cancel": {"a"},
+		"drain":  {"a", "b"},
+	}
+	for policy, expects := range policies {
+		var dispatched []string
+		err := run(t, strings.Replace(script, "%s", policy, 1), func(ctx context.Context, task *pipeline.Task, input map[string]interface{}) (*ExecutionResult, error) {
+			dispatched = append(dispatched, task.Name)
+			if task.Name == "a" {
+				return nil, errFailed
+			}
+			return &ExecutionResult{Success: true}, nil
+		})
+		if !errors.Is(err, errFailed) {
+			t.Errorf("%s: error = %v, expected the failure of a", policy, err)
+		}
+		if !reflect.DeepEqual(dispatched, expects) {
+			t.Errorf("%s: dispatched %v, expected %v", policy, dispatched, expects)
+		}
+	}
+}
+
+func TestStructuredInputs(t *testing.T) {
+	var input map[string]interface{}
+	err := run(t, `---
+vars:
+  height: 480
+stages:
+- stage: s
+  tasks:
+  - name: encode
+    service:
+      name: ffmpeg
+      height: 720
+      overwrite: true
+      args: [-vf, "scale=-2:{{ height }}", 2]
+      metadata:
+        title: bunny
+        tags: ["{{ height }}p"]
+`, func(ctx context.Context, task *pipeline.Task, i map[string]interface{}) (*ExecutionResult, error) {
+		input = i
+		return &ExecutionResult{Success: true}, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// scalars keep their type and strings are rendered at any depth
+	expects := map[string]interface{}{
+		"height":    720,
+		"overwrite": true,
+		"args":      []interface{}{"-vf", "scale=-2:480", 2},
+		"metadata": map[string]interface{}{
+			"title": "bunny",
+			"tags":  []interface{}{"480p"},
+		},
+	}
+	if !reflect.DeepEqual(input, expects) {
+		t.Errorf("input = %#v\nexpected %#v", input, expects)
+	}
+}
+
+func TestExpressionLimitsFailTheJob(t *testing.T) {
+	pi, err := pipeline.CreateFromBytes(`---
+stages:
+- stage: s
+  tasks:
+  - name: endless
+    service: shell
+    when: func() { for {} }()
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	err = NewExecutionContext("test", pi, tracking.CreateJobTracker(log.New(), nil, "test")).
+		ExpressionLimits(pipeline.ExpressionLimits{Timeout: 20 * time.Millisecond}).
+		TaskHandler(func(ctx context.Context, task *pipeline.Task, input map[string]interface{}) (*ExecutionResult, error) {
+			t.Errorf("task has been dispatched")
+			return &ExecutionResult{Success: true}, nil
+		}).
+		Run()
+	if !errors.Is(err, pipeline.ErrExpressionTimeout) {
+		t.Errorf("error = %v, expected the expression to time out", err)
+	}
+}
+
+func TestMatrix(t *testing.T) {
+	dispatched := runScript(t, `---
+stages:
+- stage: transcode
+  matrix:
+    codec: [h264, hevc]
+  tasks:
+  - name: encode
+    matrix:
+      height: [720, 480]
+    service:
+      name: shell
+      cmd: "encode {{ matrix.codec }} {{ matrix.height }}p"
+  - name: report
+    depends_on: encode
+    service:
+      name: shell
+      cmd: "report {{ matrix.codec }}"
+`)
+
+	// task combinations see the combination of their stage as well
+	expects := []string{
+		"encode h264 720p", "encode h264 480p", "report h264",
+		"encode hevc 720p", "encode hevc 480p", "report hevc",
+	}
+	if !reflect.DeepEqual(dispatched, expects) {
+		t.Errorf("dispatched %v, expected %v", dispatched, expects)
+	}
+}
@@ -0,0 +1,92 @@
+package execution
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/ko1N/dips/pkg/pipeline"
+)
+
+// runGraph - runs the tasks of the stage in the order of their dependencies
+// tasks of a parallel stage are dispatched concurrently, all other stages run one task at a time
+// ready tasks are always started in the order they have been declared in
+func (e *ExecutionContext) runGraph(ctx context.Context, stage *pipeline.Stage, stageVariables map[string]interface{}) error {
+	// planned jobs run one task at a time so the plan is ordered deterministically
+	parallelism := 1
+	if stage.Parallel && e.plan == nil {
+		parallelism = e.maxParallel
+		if stage.MaxParallel > 0 {
+			parallelism = stage.MaxParallel
+		}
+	}
+
+	// count the open dependencies of each task
+	pending := make([]int, len(stage.Tasks))
+	dependents := make([][]int, len(stage.Tasks))
+	for i, task := range stage.Tasks {
+		for _, name := range task.DependsOn {
+			for _, j := range stage.TaskIndices(name) {
+				pending[i]++
+				dependents[j] = append(dependents[j], i)
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type finished struct {
+		index int
+		err   error
+	}
+	results := make(chan finished)
+
+	started := make([]bool, len(stage.Tasks))
+	running := 0
+	var firstErr error
+	for {
+		// dispatch ready tasks, after a failure this only continues when the stage is drained
+		// nothing is dispatched anymore once the job has been cancelled or exceeded its deadline
+		for i := 0; i < len(stage.Tasks) && running < parallelism && ctx.Err() == nil; i++ {
+			if started[i] || pending[i] > 0 {
+				continue
+			}
+			if firstErr != nil && stage.FailurePolicy != pipeline.FailureDrain {
+				break
+			}
+			started[i] = true
+			running++
+			go func(i int) {
+				results <- finished{i, e.runTask(ctx, &stage.Tasks[i], stageVariables)}
+			}(i)
+		}
+
+		if running == 0 {
+			break
+		}
+
+		// dependents of failed tasks are never started
+		result := <-results
+		running--
+		if result.err != nil {
+			if firstErr == nil {
+				firstErr = failed(&stage.Tasks[result.index], stage.DisplayName(), result.err)
+				if stage.FailurePolicy != pipeline.FailureDrain {
+					cancel()
+				}
+			}
+			continue
+		}
+		for _, j := range dependents[result.index] {
+			pending[j]--
+		}
+	}
+
+	for i, task := range stage.Tasks {
+		if !started[i] {
+			e.Tracker.Warn("task " + strconv.Itoa(i+1) + " (" + task.DisplayName() + ") of stage `" + stage.DisplayName() + "` has not been executed")
+		}
+	}
+
+	return firstErr
+}
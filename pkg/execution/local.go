@@ -0,0 +1,87 @@
+package execution
+
+import (
+	"context"
+
+	"github.com/ko1N/dips/pkg/execution/tracking"
+	"github.com/ko1N/dips/pkg/pipeline"
+)
+
+// LocalTaskError - returned when an `assert` or `fail` task fails the job
+type LocalTaskError struct {
+	Type    pipeline.LocalTaskType
+	Message string
+}
+
+func (e *LocalTaskError) Error() string {
+	return e.Message
+}
+
+// runLocal - evaluates a task which is not dispatched to a service
+// local tasks are deterministic and are therefore never retried
+func (e *ExecutionContext) runLocal(ctx context.Context, task *pipeline.Task, tracker tracking.JobTracker, variables map[string]interface{}) (*ExecutionResult, error) {
+	switch task.Local {
+	case pipeline.SetFactTask:
+		return e.setFacts(ctx, task, tracker, variables)
+
+	case pipeline.AssertTask:
+		for _, condition := range task.Conditions() {
+			res, err := e.evaluate(ctx, task, task.Templates.Expression(condition), variables)
+			if err == errUnknownValue {
+				// the condition can only be checked once the job runs
+				continue
+			}
+			if err != nil {
+				trackFailure(tracker, "unable to evaluate assertion", err)
+				return nil, err
+			}
+			if res != "true" {
+				message := "assertion failed: `" + condition + "`"
+				if task.Message() != "" {
+					message, err = e.render(ctx, task, task.Templates, task.Message(), variables)
+					if err != nil {
+						trackFailure(tracker, "unable to render assertion message", err)
+						return nil, err
+					}
+				}
+				tracker.Error(message, "condition", condition)
+				return nil, &LocalTaskError{Type: task.Local, Message: message}
+			}
+		}
+		tracker.Info("all assertions passed")
+		return &ExecutionResult{Success: true, Output: map[string]interface{}{}, Attempts: 1}, nil
+
+	case pipeline.FailTask:
+		message, err := e.render(ctx, task, task.Templates, task.Message(), variables)
+		if err != nil {
+			trackFailure(tracker, "unable to render failure message", err)
+			return nil, err
+		}
+		tracker.Error(message)
+		return nil, &LocalTaskError{Type: task.Local, Message: message}
+	}
+	return nil, &LocalTaskError{Type: task.Local, Message: "unknown local task `" + string(task.Local) + "`"}
+}
+
+// setFacts - evaluates the facts of the task and stores them in the job variables
+// a fact which consists of a single `{{ expression }}` keeps the type of the expression
+func (e *ExecutionContext) setFacts(ctx context.Context, task *pipeline.Task, tracker tracking.JobTracker, variables map[string]interface{}) (*ExecutionResult, error) {
+	facts := make(map[string]interface{}, len(task.Parameters))
+	for name, value := range task.Parameters {
+		var err error
+		facts[name], err = e.typedValue(ctx, task, task.Templates, value, variables)
+		if err != nil {
+			trackFailure(tracker, "unable to evaluate fact `"+name+"`", err)
+			return nil, err
+		}
+	}
+
+	e.lock.Lock()
+	for name, value := range facts {
+		e.variables[name] = value
+	}
+	e.lock.Unlock()
+
+	tracker.Info("facts set", "facts", facts)
+	return &ExecutionResult{Success: true, Output: facts, Attempts: 1}, nil
+}
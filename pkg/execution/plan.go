@@ -0,0 +1,185 @@
+package execution
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ko1N/dips/pkg/execution/tracking"
+	"github.com/ko1N/dips/pkg/pipeline"
+)
+
+// errUnknownValue - returned when an expression references a value which is only known once the job runs
+var errUnknownValue = errors.New("value is only known once the job runs")
+
+// unknown - a placeholder for a value which is only known once the job runs, e.g. the registered result of a task
+type unknown string
+
+// Plan - the tasks a job would run in the order they would be dispatched
+type Plan struct {
+	Tasks []PlannedTask `json:"tasks"`
+	Error string        `json:"error,omitempty"` // the error the job would fail with
+
+	stage  string // stage which is currently planned, empty for the handlers at the end of the job
+	reason string // reason of all tasks of the current stage, set if the stage only runs conditionally
+}
+
+// PlannedTask - a task of the plan with its rendered input
+// values which are only known once the job runs are rendered as `<expression>`
+type PlannedTask struct {
+	ID          string                 `json:"id,omitempty"`
+	Stage       string                 `json:"stage,omitempty"`
+	Name        string                 `json:"name"`
+	Service     string                 `json:"service,omitempty"`
+	Pipeline    string                 `json:"pipeline,omitempty"`
+	Local       pipeline.LocalTaskType `json:"local,omitempty"`
+	Input       map[string]interface{} `json:"input,omitempty"`
+	Skipped     bool                   `json:"skipped"`
+	Conditional bool                   `json:"conditional"` // the task depends on a condition which is only known once the job runs
+	Reason      string                 `json:"reason,omitempty"`
+}
+
+// Plan - walks the pipeline without dispatching any task and returns the tasks the job would run
+// conditions and inputs are evaluated where their variables are known, results of tasks and of functions
+// with access to the host, e.g. `env`, are never known, loops over them are planned once and a stage with `until` is planned for its first iteration
+// the job status is not tracked, the returned error is the error the job would fail with
+func (e *ExecutionContext) Plan() (*Plan, error) {
+	e.plan = &Plan{Tasks: []PlannedTask{}}
+	err := e.run(context.Background())
+	if err != nil {
+		e.plan.Error = err.Error()
+	}
+	return e.plan, err
+}
+
+// dependsOnUnknown - checks if the expression references a value which is only known once the job runs
+// functions with access to the host, e.g. `env`, are not evaluated by a plan, their results are unknown as well
+func (e *ExecutionContext) dependsOnUnknown(expr *pipeline.Expression, variables map[string]interface{}) bool {
+	if e.plan == nil {
+		return false
+	}
+	names, err := expr.Variables()
+	if err != nil {
+		// the evaluation reports the error
+		return false
+	}
+	for _, name := range names {
+		if _, ok := variables[name].(unknown); ok {
+			return true
+		}
+	}
+
+	functions, _ := expr.HostFunctions()
+	for _, name := range functions {
+		// a variable of the same name shadows the function
+		if _, ok := variables[name]; !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// planStage - starts planning the tasks of the stage, reason is set if the stage only runs conditionally
+func (e *ExecutionContext) planStage(stage string, reason string) {
+	if e.plan != nil {
+		e.plan.stage = stage
+		e.plan.reason = reason
+	}
+}
+
+// planSkippedStage - adds all tasks of the skipped stage to the plan
+func (e *ExecutionContext) planSkippedStage(stage *pipeline.Stage, reason string) {
+	if e.plan == nil {
+		return
+	}
+	for i := range stage.Tasks {
+		e.planSkipped(&stage.Tasks[i], nil, reason)
+	}
+}
+
+// planSkipped - adds the skipped task to the plan
+func (e *ExecutionContext) planSkipped(task *pipeline.Task, tracker *tracking.JobTracker, reason string) {
+	if e.plan == nil {
+		return
+	}
+	planned := e.planned(task, tracker, "")
+	planned.Skipped = true
+	planned.Reason = reason
+	e.addPlanned(planned)
+}
+
+// planTask - adds the task with its rendered input to the plan instead of dispatching it
+// `set_fact` is evaluated so later tasks can use the facts, `assert` and `fail` only fail the plan
+// if they are not conditional, results of all other tasks are only known once the job runs
+func (e *ExecutionContext) planTask(ctx context.Context, task *pipeline.Task, tracker tracking.JobTracker, variables map[string]interface{}, reason string) (*ExecutionResult, error) {
+	planned := e.planned(task, &tracker, reason)
+	if _, ok := variables["item"].(unknown); ok {
+		planned.Reason = joinReasons(planned.Reason, "the items of the loop are only known once the job runs, the task is planned once")
+	}
+
+	switch task.Local {
+	case pipeline.SetFactTask:
+		result, err := e.setFacts(ctx, task, tracker, variables)
+		if err != nil {
+			return nil, err
+		}
+		planned.Input = result.Output
+		e.addPlanned(planned)
+		return result, nil
+
+	case pipeline.AssertTask, pipeline.FailTask:
+		result, err := e.runLocal(ctx, task, tracker, variables)
+		var localErr *LocalTaskError
+		if errors.As(err, &localErr) && planned.Conditional {
+			planned.Reason = joinReasons(planned.Reason, "if it runs it fails the job: "+localErr.Message)
+			e.addPlanned(planned)
+			return &ExecutionResult{Success: true, Output: map[string]interface{}{}, Attempts: 1}, nil
+		}
+		e.addPlanned(planned)
+		return result, err
+	}
+
+	input := make(map[string]interface{})
+	inputVariables := e.withSecrets(variables, tracker)
+	for key, value := range task.Parameters {
+		var err error
+		input[key], err = e.renderValue(ctx, task, task.Templates, value, inputVariables)
+		if err != nil {
+			trackFailure(tracker, "unable to render task input `"+key+"`", err)
+			return nil, err
+		}
+	}
+	planned.Input = input
+	e.addPlanned(planned)
+	return &ExecutionResult{Success: true, Attempts: 1}, nil
+}
+
+// planned - returns the entry of the task in the plan, tracker is nil for tasks which have not been started
+// reason is set if the task only runs conditionally
+func (e *ExecutionContext) planned(task *pipeline.Task, tracker *tracking.JobTracker, reason string) PlannedTask {
+	planned := PlannedTask{
+		Stage:       e.plan.stage,
+		Name:        task.DisplayName(),
+		Service:     task.Service,
+		Pipeline:    task.Pipeline,
+		Local:       task.Local,
+		Conditional: reason != "" || e.plan.reason != "",
+		Reason:      joinReasons(e.plan.reason, reason),
+	}
+	if tracker != nil {
+		planned.ID = tracker.TaskId()
+	}
+	return planned
+}
+
+func joinReasons(a string, b string) string {
+	if a == "" || b == "" {
+		return a + b
+	}
+	return a + ", " + b
+}
+
+func (e *ExecutionContext) addPlanned(planned PlannedTask) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.plan.Tasks = append(e.plan.Tasks, planned)
+}
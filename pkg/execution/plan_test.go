@@ -0,0 +1,161 @@
+package execution
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ko1N/dips/pkg/execution/tracking"
+	"github.com/ko1N/dips/pkg/pipeline"
+)
+
+func TestPlan(t *testing.T) {
+	t.Setenv("DIPS_PLAN_TEST", "host value")
+	pipeline.AllowEnv("DIPS_PLAN_TEST")
+	t.Cleanup(func() { pipeline.DisallowEnv("DIPS_PLAN_TEST") })
+
+	tests := []struct {
+		name      string
+		script    string
+		variables map[string]interface{}
+		expects   []PlannedTask
+		error     string
+	}{
+		{
+			name: "rendered inputs",
+			script: `---
+stages:
+- stage: s
+  tasks:
+  - name: greet
+    shell: "echo {{ who }}"
+`,
+			variables: map[string]interface{}{"who": "world"},
+			expects: []PlannedTask{
+				{ID: "1", Stage: "s", Name: "greet", Service: "shell", Input: map[string]interface{}{"cmd": "echo world"}},
+			},
+		},
+		{
+			name: "results of tasks are unknown",
+			script: `---
+stages:
+- stage: s
+  tasks:
+  - name: probe
+    shell: probe
+    register: probe
+  - name: report
+    shell: "echo {{ probe.output.codec }}"
+`,
+			expects: []PlannedTask{
+				{ID: "1", Stage: "s", Name: "probe", Service: "shell", Input: map[string]interface{}{"cmd": "probe"}},
+				{ID: "2", Stage: "s", Name: "report", Service: "shell", Input: map[string]interface{}{"cmd": "echo <probe.output.codec>"}},
+			},
+		},
+		{
+			name: "host functions are unknown",
+			script: `---
+stages:
+- stage: s
+  tasks:
+  - name: host
+    shell: '{{ env("DIPS_PLAN_TEST") }}'
+`,
+			expects: []PlannedTask{
+				{ID: "1", Stage: "s", Name: "host", Service: "shell", Input: map[string]interface{}{"cmd": `<env("DIPS_PLAN_TEST")>`}},
+			},
+		},
+		{
+			name: "variables shadow host functions",
+			script: `---
+stages:
+- stage: s
+  tasks:
+  - name: shadowed
+    shell: '{{ env }}'
+`,
+			variables: map[string]interface{}{"env": "production"},
+			expects: []PlannedTask{
+				{ID: "1", Stage: "s", Name: "shadowed", Service: "shell", Input: map[string]interface{}{"cmd": "production"}},
+			},
+		},
+		{
+			name: "secrets are not resolved",
+			script: `---
+stages:
+- stage: s
+  tasks:
+  - name: login
+    shell: 'login {{ secret("db") }}'
+`,
+			expects: []PlannedTask{
+				{ID: "1", Stage: "s", Name: "login", Service: "shell", Input: map[string]interface{}{"cmd": "login <secret `db`>"}},
+			},
+		},
+		{
+			name: "skipped and conditional tasks",
+			script: `---
+stages:
+- stage: s
+  tasks:
+  - name: probe
+    shell: probe
+    register: probe
+  - name: never
+    when: "false"
+    shell: never
+  - name: maybe
+    when: probe.success
+    shell: maybe
+`,
+			expects: []PlannedTask{
+				{ID: "1", Stage: "s", Name: "probe", Service: "shell", Input: map[string]interface{}{"cmd": "probe"}},
+				{ID: "2", Stage: "s", Name: "never", Service: "shell", Skipped: true, Reason: "`when` condition `false` is not met"},
+				{ID: "3", Stage: "s", Name: "maybe", Service: "shell", Input: map[string]interface{}{"cmd": "maybe"}, Conditional: true, Reason: "only runs if its `when` condition `probe.success` is met"},
+			},
+		},
+		{
+			name: "failing assertion",
+			script: `---
+stages:
+- stage: s
+  tasks:
+  - name: check
+    assert:
+      that: [height > 100]
+  - name: after
+    shell: after
+`,
+			variables: map[string]interface{}{"height": 10},
+			expects: []PlannedTask{
+				{ID: "1", Stage: "s", Name: "check", Local: pipeline.AssertTask},
+			},
+			error: "assertion failed: `height > 100`",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pi, err := pipeline.CreateFromBytes(tt.script)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			variables := tt.variables
+			if variables == nil {
+				variables = map[string]interface{}{}
+			}
+
+			plan, err := NewExecutionContext("plan", pi, tracking.CreateDiscardTracker("plan")).
+				Variables(variables).
+				Plan()
+			if plan.Error != tt.error {
+				t.Errorf("error = %q, expected %q", plan.Error, tt.error)
+			}
+			if (err != nil) != (tt.error != "") {
+				t.Errorf("returned error = %v, expected %q", err, tt.error)
+			}
+			if !reflect.DeepEqual(plan.Tasks, tt.expects) {
+				t.Errorf("tasks = %+v\nexpected %+v", plan.Tasks, tt.expects)
+			}
+		})
+	}
+}
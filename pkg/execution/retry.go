@@ -0,0 +1,127 @@
+package execution
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ko1N/dips/pkg/dipscl"
+	"github.com/ko1N/dips/pkg/execution/tracking"
+	"github.com/ko1N/dips/pkg/pipeline"
+)
+
+// errorClass - classifies an error returned by the task handler
+func errorClass(err error) string {
+	var taskErr *dipscl.TaskError
+	switch {
+	case errors.Is(err, dipscl.ErrTaskTimeout), errors.Is(err, context.DeadlineExceeded), errors.Is(err, ErrJobTimeout):
+		return pipeline.TimeoutErrorClass
+	case errors.As(err, &taskErr):
+		return pipeline.FailureErrorClass
+	}
+	return pipeline.DispatchErrorClass
+}
+
+// dispatch - sends the task to the task handler and retries it according to the retry policy of the task
+func (e *ExecutionContext) dispatch(ctx context.Context, task *pipeline.Task, tracker tracking.JobTracker, input map[string]interface{}, variables map[string]interface{}) (*ExecutionResult, error) {
+	retries := e.retries
+	if task.Pipeline != "" {
+		retries = 0
+	}
+	if task.Retry.Retries != nil {
+		retries = *task.Retry.Retries
+	}
+
+	retry := &task.Retry
+	for attempt := 1; ; attempt++ {
+		tracker.Info("dispatching task", "input", input, "attempt", attempt)
+		result, err := e.attempt(ctx, task, tracker, input)
+		if err == nil {
+			if result != nil {
+				result.Attempts = attempt
+			}
+			return result, nil
+		}
+
+		// a cancelled job is never retried
+		if attempt > retries || ctx.Err() != nil || !e.shouldRetry(ctx, task, tracker, err, attempt, variables) {
+			tracker.Error("task execution failed", "error", err, "attempt", attempt)
+			return e.ignoreError(ctx, task, tracker, err, attempt)
+		}
+
+		delay := retry.DelayFor(attempt)
+		tracker.Warn("task attempt failed, retrying", "error", err, "attempt", attempt, "delay", delay)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// ignoreError - returns the failed result of a task with `ignore_errors` instead of the error
+// the result is registered like any other result but does not notify handlers, a cancelled job is never ignored
+func (e *ExecutionContext) ignoreError(ctx context.Context, task *pipeline.Task, tracker tracking.JobTracker, err error, attempts int) (*ExecutionResult, error) {
+	if !task.IgnoreErrors || ctx.Err() != nil {
+		return nil, err
+	}
+	tracker.Warn("task failed, ignoring the error", "error", err)
+	msg := err.Error()
+	return &ExecutionResult{
+		Success:  false,
+		Error:    &msg,
+		Output:   map[string]interface{}{},
+		Attempts: attempts,
+	}, nil
+}
+
+// attempt - runs the task handler once, the attempt is cancelled when it exceeds the timeout of the task
+func (e *ExecutionContext) attempt(ctx context.Context, task *pipeline.Task, tracker tracking.JobTracker, input map[string]interface{}) (*ExecutionResult, error) {
+	if task.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(task.Timeout))
+		defer cancel()
+	}
+	if task.Pipeline != "" {
+		return e.runPipeline(ctx, task, tracker, input)
+	}
+	return (e.taskHandler)(ctx, task, input)
+}
+
+// shouldRetry - checks if the error matches one of the `retry_on` filters
+// a filter is either an error class or an expression which has access to `message`, `class` and `attempt`
+// filters whose expression cannot be evaluated do not match
+func (e *ExecutionContext) shouldRetry(ctx context.Context, task *pipeline.Task, tracker tracking.JobTracker, err error, attempt int, variables map[string]interface{}) bool {
+	retry := &task.Retry
+	if len(retry.On) == 0 {
+		return true
+	}
+
+	class := errorClass(err)
+	for _, filter := range retry.On {
+		if pipeline.IsErrorClass(filter) {
+			if filter == class {
+				return true
+			}
+			continue
+		}
+
+		scope := make(map[string]interface{}, len(variables)+3)
+		for key, value := range variables {
+			scope[key] = value
+		}
+		scope["message"] = err.Error()
+		scope["class"] = class
+		scope["attempt"] = attempt
+
+		res, err := e.evaluate(ctx, task, task.Templates.Expression(filter), scope)
+		if err != nil {
+			trackFailure(tracker, "unable to evaluate `retry_on` filter", err)
+			continue
+		}
+		if res == "true" {
+			return true
+		}
+	}
+	return false
+}
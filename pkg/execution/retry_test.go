@@ -0,0 +1,130 @@
+package execution
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/ko1N/dips/pkg/dipscl"
+	"github.com/ko1N/dips/pkg/pipeline"
+)
+
+// countAttempts - runs a single task with the given retry settings which fails with the error
+// returned by fail and returns how often the task has been dispatched
+func countAttempts(t *testing.T, retry string, fail func(attempt int) error) (int, error) {
+	t.Helper()
+
+	attempts := 0
+	err := run(t, `---
+stages:
+- stage: s
+  tasks:
+  - name: flaky
+    service: shell
+    retry_delay: 1ms
+`+retry, func(ctx context.Context, task *pipeline.Task, input map[string]interface{}) (*ExecutionResult, error) {
+		attempts++
+		if err := fail(attempts); err != nil {
+			return nil, err
+		}
+		return &ExecutionResult{Success: true}, nil
+	})
+	return attempts, err
+}
+
+func TestRetries(t *testing.T) {
+	always := func(int) error { return errFailed }
+
+	attempts, err := countAttempts(t, "", always)
+	if attempts != defaultRetries+1 || !errors.Is(err, errFailed) {
+		t.Errorf("default retries: %d attempts (%v), expected %d failed attempts", attempts, err, defaultRetries+1)
+	}
+
+	attempts, err = countAttempts(t, "    retries: 0\n", always)
+	if attempts != 1 || !errors.Is(err, errFailed) {
+		t.Errorf("retries: 0: %d attempts (%v), expected a single failed attempt", attempts, err)
+	}
+
+	attempts, err = countAttempts(t, "    retries: 2\n", always)
+	if attempts != 3 || !errors.Is(err, errFailed) {
+		t.Errorf("retries: 2: %d attempts (%v), expected 3 failed attempts", attempts, err)
+	}
+
+	attempts, err = countAttempts(t, "    retries: 5\n    backoff: exponential\n", func(attempt int) error {
+		if attempt < 3 {
+			return errFailed
+		}
+		return nil
+	})
+	if attempts != 3 || err != nil {
+		t.Errorf("recovering task: %d attempts (%v), expected success on the third attempt", attempts, err)
+	}
+}
+
+func TestRetryOn(t *testing.T) {
+	timeout := func(int) error { return dipscl.ErrTaskTimeout }
+	busy := func(attempt int) error { return fmt.Errorf("busy (%d)", attempt) }
+
+	for _, tt := range []struct {
+		retryOn  string
+		fail     func(int) error
+		attempts int
+	}{
+		{"[timeout]", timeout, 4},
+		{"[timeout]", busy, 1},
+		{"[failure, error]", busy, 4},
+		{"[attempt < 2]", busy, 2},
+		{`['message == "busy (1)"']`, busy, 2},
+		{`[class == "timeout"]`, timeout, 4},
+	} {
+		attempts, err := countAttempts(t, "    retries: 3\n    retry_on: "+tt.retryOn+"\n", tt.fail)
+		if err == nil {
+			t.Errorf("retry_on: %s: task did not fail", tt.retryOn)
+		}
+		if attempts != tt.attempts {
+			t.Errorf("retry_on: %s: %d attempts, expected %d", tt.retryOn, attempts, tt.attempts)
+		}
+	}
+}
+
+func TestIgnoreErrors(t *testing.T) {
+	var dispatched []string
+	err := run(t, `---
+stages:
+- stage: s
+  tasks:
+  - name: flaky
+    service: shell
+    retries: 1
+    retry_delay: 1ms
+    ignore_errors: true
+    register: flaky
+    notify: cleanup
+  - name: report
+    service:
+      name: shell
+      cmd: "{{ flaky.success }} after {{ flaky.attempts }} attempts: {{ flaky[\"error\"] }}"
+handlers:
+- name: cleanup
+  service: shell
+`, func(ctx context.Context, task *pipeline.Task, input map[string]interface{}) (*ExecutionResult, error) {
+		if task.Name == "flaky" {
+			dispatched = append(dispatched, task.Name)
+			return nil, errFailed
+		}
+		cmd, _ := input["cmd"].(string)
+		dispatched = append(dispatched, task.Name+": "+cmd)
+		return &ExecutionResult{Success: true}, nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	// the failed result is registered, but does not notify any handler
+	expects := []string{"flaky", "flaky", "report: false after 2 attempts: task failed"}
+	if !reflect.DeepEqual(dispatched, expects) {
+		t.Errorf("dispatched %v, expected %v", dispatched, expects)
+	}
+}
@@ -0,0 +1,57 @@
+package execution
+
+import (
+	"errors"
+
+	"github.com/d5/tengo/v2"
+	"github.com/ko1N/dips/pkg/execution/tracking"
+)
+
+// SecretResolverFunc - returns the value of the secret with the given name
+type SecretResolverFunc func(name string) (string, error)
+
+// Secrets - Sets the resolver for `secret("name")` in task inputs
+func (e *ExecutionContext) Secrets(resolver SecretResolverFunc) *ExecutionContext {
+	e.secrets = resolver
+	return e
+}
+
+// withSecrets - adds the `secret` function to the variables used to render the task input
+// secrets are only resolved right before a task is dispatched and every resolved value is redacted from the tracker
+func (e *ExecutionContext) withSecrets(variables map[string]interface{}, tracker tracking.JobTracker) map[string]interface{} {
+	result := make(map[string]interface{}, len(variables)+1)
+	for k, v := range variables {
+		result[k] = v
+	}
+	result["secret"] = &tengo.UserFunction{
+		Name: "secret",
+		Value: func(args ...tengo.Object) (tengo.Object, error) {
+			if len(args) != 1 {
+				return nil, tengo.ErrWrongNumArguments
+			}
+			name, ok := tengo.ToString(args[0])
+			if !ok {
+				return nil, tengo.ErrInvalidArgumentType{
+					Name:     "name",
+					Expected: "string",
+					Found:    args[0].TypeName(),
+				}
+			}
+			if e.plan != nil {
+				// planned jobs never resolve secrets
+				return &tengo.String{Value: "<secret `" + name + "`>"}, nil
+			}
+			if e.secrets == nil {
+				return nil, errors.New("unable to resolve secret `" + name + "`: no secret store configured")
+			}
+
+			value, err := e.secrets(name)
+			if err != nil {
+				return nil, errors.New("unable to resolve secret `" + name + "`: " + err.Error())
+			}
+			tracker.Redact(value)
+			return &tengo.String{Value: value}, nil
+		},
+	}
+	return result
+}
@@ -0,0 +1,64 @@
+package execution
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/ko1N/dips/pkg/execution/tracking"
+	"github.com/ko1N/dips/pkg/pipeline"
+)
+
+const secretScript = `---
+stages:
+- stage: s
+  tasks:
+  - name: login
+    service:
+      name: shell
+      cmd: 'login {{ secret("db") }}'
+`
+
+func TestSecretsAreResolvedForTaskInputs(t *testing.T) {
+	pi, err := pipeline.CreateFromBytes(secretScript)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var resolved []string
+	var cmd string
+	err = NewExecutionContext("test", pi, tracking.CreateJobTracker(log.New(), nil, "test")).
+		Secrets(func(name string) (string, error) {
+			resolved = append(resolved, name)
+			if name != "db" {
+				return "", errors.New("not found")
+			}
+			return "hunter2", nil
+		}).
+		TaskHandler(func(ctx context.Context, task *pipeline.Task, input map[string]interface{}) (*ExecutionResult, error) {
+			cmd, _ = input["cmd"].(string)
+			return &ExecutionResult{Success: true}, nil
+		}).
+		Run()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	if cmd != "login hunter2" {
+		t.Errorf("task received %q, expected the resolved secret", cmd)
+	}
+	if len(resolved) != 1 {
+		t.Errorf("secrets %v have been resolved, expected db once", resolved)
+	}
+}
+
+func TestSecretsWithoutStore(t *testing.T) {
+	err := run(t, secretScript, func(ctx context.Context, task *pipeline.Task, input map[string]interface{}) (*ExecutionResult, error) {
+		t.Errorf("task has been dispatched with %v", input)
+		return &ExecutionResult{Success: true}, nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "unable to resolve secret `db`: no secret store configured") {
+		t.Errorf("error = %v, expected a missing secret store", err)
+	}
+}
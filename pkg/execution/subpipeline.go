@@ -0,0 +1,58 @@
+package execution
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/ko1N/dips/pkg/execution/tracking"
+	"github.com/ko1N/dips/pkg/pipeline"
+)
+
+// runPipeline - runs the sub-pipeline of the task as a child job which is tracked under the task
+// the input of the task is validated against the parameters of the sub-pipeline
+func (e *ExecutionContext) runPipeline(ctx context.Context, task *pipeline.Task, tracker tracking.JobTracker, input map[string]interface{}) (*ExecutionResult, error) {
+	if e.depth >= e.maxDepth {
+		return nil, errors.New("sub-pipelines cannot be nested deeper than " + strconv.Itoa(e.maxDepth) + " levels")
+	}
+
+	sub, ok := e.pipelines[task.Pipeline]
+	if !ok {
+		return nil, errors.New("unknown pipeline `" + task.Pipeline + "`")
+	}
+
+	variables, err := sub.ValidateParameters(input)
+	if err != nil {
+		return nil, err
+	}
+
+	child := e.child(tracker.JobId()+"/"+tracker.TaskId(), sub, tracker).
+		Variables(variables)
+
+	tracker.Info("------ Starting Pipeline: "+child.JobID, "pipeline", task.Pipeline)
+	defer tracker.Info("------ Finished Pipeline: " + child.JobID)
+
+	err = child.run(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ExecutionResult{
+		Success: true,
+		Output:  child.Outputs(),
+	}, nil
+}
+
+// child - creates the execution context of a sub-pipeline which shares all settings of this context
+func (e *ExecutionContext) child(jobID string, sub *pipeline.Pipeline, tracker tracking.JobTracker) *ExecutionContext {
+	child := NewExecutionContext(jobID, sub, tracker)
+	child.taskHandler = e.taskHandler
+	child.maxParallel = e.maxParallel
+	child.maxDepth = e.maxDepth
+	child.retries = e.retries
+	child.secrets = e.secrets
+	child.limits = e.limits
+	child.pipelines = e.pipelines
+	child.depth = e.depth + 1
+	return child
+}
@@ -0,0 +1,61 @@
+package execution
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	log "github.com/inconshreveable/log15"
+	"github.com/ko1N/dips/pkg/execution/tracking"
+	"github.com/ko1N/dips/pkg/pipeline"
+)
+
+// scripts - loads pipelines by their name from memory
+type scripts map[string]string
+
+func (s scripts) Load(from string, ref string) (string, string, error) {
+	script, ok := s[ref]
+	if !ok {
+		return ref, "", errors.New("not found")
+	}
+	return ref, script, nil
+}
+
+func TestSubPipelineSharesSettings(t *testing.T) {
+	pi, err := pipeline.NewParser().
+		Loader(scripts{"upload.pipe": `---
+stages:
+- stage: upload
+  tasks:
+  - name: upload
+    shell: upload
+    retry_delay: 1ms
+`}).
+		Parse("main.pipe", `---
+stages:
+- stage: s
+  tasks:
+  - name: child
+    pipeline: upload.pipe
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	attempts := 0
+	err = NewExecutionContext("test", pi, tracking.CreateJobTracker(log.New(), nil, "test")).
+		DefaultRetries(2).
+		TaskHandler(func(ctx context.Context, task *pipeline.Task, input map[string]interface{}) (*ExecutionResult, error) {
+			attempts++
+			return nil, errFailed
+		}).
+		Run()
+	if !errors.Is(err, errFailed) {
+		t.Errorf("error = %v, expected the failure of the child task", err)
+	}
+
+	// the task of the child is retried, the sub-pipeline task itself is not
+	if attempts != 3 {
+		t.Errorf("child task has been attempted %d times, expected 3", attempts)
+	}
+}
@@ -0,0 +1,106 @@
+package execution
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ko1N/dips/pkg/execution/tracking"
+	"github.com/ko1N/dips/pkg/pipeline"
+)
+
+// renderValue - renders all strings in the value, maps and lists are rendered recursively
+// templates are the compiled templates of the value, task is nil for variables of the pipeline and its stages
+func (e *ExecutionContext) renderValue(ctx context.Context, task *pipeline.Task, templates pipeline.Templates, value interface{}, variables map[string]interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		return e.render(ctx, task, templates, v, variables)
+
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, entry := range v {
+			var err error
+			result[i], err = e.renderValue(ctx, task, templates, entry, variables)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, entry := range v {
+			var err error
+			result[key], err = e.renderValue(ctx, task, templates, entry, variables)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	}
+	return value, nil
+}
+
+// typedValue - renders the value, a string which only consists of a single `{{ expression }}` keeps the type of the expression
+// a planned job keeps such a value unknown if the expression depends on values which are only known once the job runs
+func (e *ExecutionContext) typedValue(ctx context.Context, task *pipeline.Task, templates pipeline.Templates, value interface{}, variables map[string]interface{}) (interface{}, error) {
+	script, ok := pipeline.SingleTemplate(value)
+	if !ok {
+		return e.renderValue(ctx, task, templates, value, variables)
+	}
+	result, err := e.value(ctx, task, templates.Expression(script), variables)
+	if err == errUnknownValue {
+		return unknown(script), nil
+	}
+	return result, err
+}
+
+// render - replaces all `{{ expression }}` occurrences in value with the result of the expression
+// task is nil for variables of the pipeline and its stages
+func (e *ExecutionContext) render(ctx context.Context, task *pipeline.Task, templates pipeline.Templates, value string, variables map[string]interface{}) (string, error) {
+	return pipeline.RenderTemplates(value, func(script string) (string, error) {
+		v, err := e.evaluate(ctx, task, templates.Expression(script), variables)
+		if err == errUnknownValue {
+			// planned jobs keep the expression of values which are only known once the job runs
+			return "<" + script + ">", nil
+		}
+		return v, err
+	})
+}
+
+// evaluate - evaluates the expression within the expression limits of the execution
+// errUnknownValue is returned if the job is planned and the expression depends on the result of a task
+func (e *ExecutionContext) evaluate(ctx context.Context, task *pipeline.Task, expr *pipeline.Expression, variables map[string]interface{}) (string, error) {
+	if e.dependsOnUnknown(expr, variables) {
+		return "", errUnknownValue
+	}
+	result, err := expr.EvaluateContext(ctx, &e.limits, variables)
+	return result, withTask(err, task)
+}
+
+// value - evaluates the expression within the expression limits of the execution and returns the result as a go value
+func (e *ExecutionContext) value(ctx context.Context, task *pipeline.Task, expr *pipeline.Expression, variables map[string]interface{}) (interface{}, error) {
+	if e.dependsOnUnknown(expr, variables) {
+		return nil, errUnknownValue
+	}
+	result, err := expr.ValueContext(ctx, &e.limits, variables)
+	return result, withTask(err, task)
+}
+
+// withTask - adds the name of the task to a failed expression
+func withTask(err error, task *pipeline.Task) error {
+	var exprErr *pipeline.ExpressionError
+	if task != nil && errors.As(err, &exprErr) {
+		exprErr.Task = task.DisplayName()
+	}
+	return err
+}
+
+// trackFailure - reports the error to the tracker, failed expressions are reported with their script and task
+func trackFailure(tracker tracking.JobTracker, msg string, err error) {
+	var exprErr *pipeline.ExpressionError
+	if errors.As(err, &exprErr) {
+		tracker.Error(msg, "expression", exprErr.Script, "name", exprErr.Task, "error", exprErr.Err)
+		return
+	}
+	tracker.Error(msg, "error", err)
+}
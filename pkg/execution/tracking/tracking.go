@@ -2,18 +2,22 @@ package tracking
 
 import (
 	"fmt"
+	"strings"
 
 	log "github.com/inconshreveable/log15"
+	"github.com/ko1N/dips/internal/persistence/database/model"
 	"github.com/ko1N/dips/pkg/dipscl"
 	"github.com/mattn/go-colorable"
 )
 
 // Tracks job status, progress and logs
 type JobTracker struct {
-	logger log.Logger
-	client *dipscl.Client
-	jobId  string
-	taskId string
+	logger    log.Logger
+	jobLogger log.Logger // logger without the task context, used for sub-tasks
+	client    *dipscl.Client
+	jobId     string
+	taskId    string
+	redactor  *redactor // shared with all sub-trackers
 }
 
 // Creates a new job tracking instance
@@ -24,10 +28,12 @@ func CreateJobTracker(logger log.Logger, cl *dipscl.Client, jobId string) JobTra
 	))
 
 	tracker := JobTracker{
-		logger: l,
-		client: cl,
-		jobId:  jobId,
-		taskId: "",
+		logger:    l,
+		jobLogger: l,
+		client:    cl,
+		jobId:     jobId,
+		taskId:    "",
+		redactor:  &redactor{},
 	}
 	tracker.Info("tracker for job `" + jobId + "` created")
 	return tracker
@@ -41,15 +47,60 @@ func CreateTaskTracker(logger log.Logger, cl *dipscl.Client, jobId string, taskI
 	))
 
 	tracker := JobTracker{
-		logger: l,
-		client: cl,
-		jobId:  jobId,
-		taskId: taskId,
+		logger:    l,
+		jobLogger: l,
+		client:    cl,
+		jobId:     jobId,
+		taskId:    taskId,
+		redactor:  &redactor{},
 	}
 	tracker.Info("tracker for task `" + taskId + "` created")
 	return tracker
 }
 
+// Creates a tracker which discards all messages and events, used when a job is only planned
+func CreateDiscardTracker(jobId string) JobTracker {
+	l := log.New("job", jobId)
+	l.SetHandler(log.DiscardHandler())
+
+	return JobTracker{
+		logger:    l,
+		jobLogger: l,
+		jobId:     jobId,
+		redactor:  &redactor{},
+	}
+}
+
+// Creates a tracker for a sub-task of the job or task that is currently tracked
+func (t *JobTracker) Task(taskId string) JobTracker {
+	if t.taskId != "" {
+		taskId = t.taskId + "." + taskId
+	}
+	return JobTracker{
+		logger:    t.jobLogger.New("task", taskId),
+		jobLogger: t.jobLogger,
+		client:    t.client,
+		jobId:     t.jobId,
+		taskId:    taskId,
+		redactor:  t.redactor,
+	}
+}
+
+// Redacts the secret value from all messages of this tracker and all of its sub-trackers
+func (t *JobTracker) Redact(secret string) {
+	t.redactor.add(secret)
+}
+
+// Returns the id of the tracked job
+func (t *JobTracker) JobId() string {
+	return t.jobId
+}
+
+// Returns the id of the tracked task or an empty string if the whole job is tracked
+func (t *JobTracker) TaskId() string {
+	return t.taskId
+}
+
 // Tracks progress of the current task
 func (t *JobTracker) Progress(progress uint) {
 	if t.client == nil {
@@ -65,6 +116,48 @@ func (t *JobTracker) Progress(progress uint) {
 		Dispatch()
 }
 
+// Tracks the status of the job
+func (t *JobTracker) Status(status model.JobStatus) {
+	if t.client == nil {
+		return
+	}
+	t.client.NewEvent().
+		Status(&dipscl.StatusEvent{
+			JobId:     t.jobId,
+			Type:      dipscl.JobStatusEvent,
+			JobStatus: status,
+		}).
+		Dispatch()
+}
+
+// Tracks the status of a stage of the job
+func (t *JobTracker) StageStatus(stage string, status model.StageStatus) {
+	if t.client == nil {
+		return
+	}
+	t.client.NewEvent().
+		Status(&dipscl.StatusEvent{
+			JobId:       t.jobId,
+			Type:        dipscl.StageStatusEvent,
+			Stage:       stage,
+			StageStatus: status,
+		}).
+		Dispatch()
+}
+
+// Tracks the outputs of the finished job, secrets are redacted before the outputs are persisted
+func (t *JobTracker) Result(outputs map[string]interface{}) {
+	if t.client == nil {
+		return
+	}
+	t.client.NewEvent().
+		Result(&dipscl.ResultEvent{
+			JobId:   t.jobId,
+			Outputs: t.redactor.value(outputs).(map[string]interface{}),
+		}).
+		Dispatch()
+}
+
 func (t *JobTracker) log(ty dipscl.MessageEventType, msg string) {
 	if t.client == nil || msg == "" {
 		// do not persist empty messages
@@ -81,37 +174,62 @@ func (t *JobTracker) log(ty dipscl.MessageEventType, msg string) {
 		Dispatch()
 }
 
+// format - renders the message and its key/value context the same way log15 does
+func format(msg string, ctx []interface{}) string {
+	if len(ctx) == 0 {
+		return msg
+	}
+
+	var b strings.Builder
+	b.WriteString(msg)
+	for i := 0; i < len(ctx); i += 2 {
+		if i+1 < len(ctx) {
+			fmt.Fprintf(&b, " %v=%v", ctx[i], ctx[i+1])
+		} else {
+			fmt.Fprintf(&b, " %v", ctx[i])
+		}
+	}
+	return b.String()
+}
+
 func (t *JobTracker) Debug(msg string, ctx ...interface{}) {
+	msg, ctx = t.redactor.string(msg), t.redactor.ctx(ctx)
 	t.logger.Debug(msg, ctx...)
-	t.log(dipscl.LogDebugMessage, fmt.Sprintf(msg, ctx...))
+	t.log(dipscl.LogDebugMessage, format(msg, ctx))
 }
 
 func (t *JobTracker) Info(msg string, ctx ...interface{}) {
+	msg, ctx = t.redactor.string(msg), t.redactor.ctx(ctx)
 	t.logger.Info(msg, ctx...)
-	t.log(dipscl.LogInfoMessage, fmt.Sprintf(msg, ctx...))
+	t.log(dipscl.LogInfoMessage, format(msg, ctx))
 }
 
 func (t *JobTracker) Warn(msg string, ctx ...interface{}) {
+	msg, ctx = t.redactor.string(msg), t.redactor.ctx(ctx)
 	t.logger.Warn(msg, ctx...)
-	t.log(dipscl.LogWarnMessage, fmt.Sprintf(msg, ctx...))
+	t.log(dipscl.LogWarnMessage, format(msg, ctx))
 }
 
 func (t *JobTracker) Error(msg string, ctx ...interface{}) {
+	msg, ctx = t.redactor.string(msg), t.redactor.ctx(ctx)
 	t.logger.Error(msg, ctx...)
-	t.log(dipscl.LogErrorMessage, fmt.Sprintf(msg, ctx...))
+	t.log(dipscl.LogErrorMessage, format(msg, ctx))
 }
 
 func (t *JobTracker) Crit(msg string, ctx ...interface{}) {
+	msg, ctx = t.redactor.string(msg), t.redactor.ctx(ctx)
 	t.logger.Crit(msg, ctx...)
-	t.log(dipscl.LogCritMessage, fmt.Sprintf(msg, ctx...))
+	t.log(dipscl.LogCritMessage, format(msg, ctx))
 }
 
 func (t *JobTracker) StdOut(msg string, ctx ...interface{}) {
+	msg, ctx = t.redactor.string(msg), t.redactor.ctx(ctx)
 	fmt.Println(msg)
-	t.log(dipscl.StdOutMessage, fmt.Sprintf(msg, ctx...))
+	t.log(dipscl.StdOutMessage, format(msg, ctx))
 }
 
 func (t *JobTracker) StdErr(msg string, ctx ...interface{}) {
+	msg, ctx = t.redactor.string(msg), t.redactor.ctx(ctx)
 	fmt.Println(msg)
-	t.log(dipscl.StdErrMessage, fmt.Sprintf(msg, ctx...))
+	t.log(dipscl.StdErrMessage, format(msg, ctx))
 }
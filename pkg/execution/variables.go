@@ -0,0 +1,67 @@
+package execution
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ko1N/dips/pkg/pipeline"
+)
+
+// Variables are resolved in the following order, the first match wins:
+//   1. task variables (`vars` of the task)
+//   2. stage variables (`vars` of the current stage)
+//   3. job variables and registered task results
+//   4. pipeline variables (`vars` of the pipeline) and parameter defaults, these only act as defaults
+
+// scope - merges the job variables with the given layers, later layers shadow earlier ones
+func (e *ExecutionContext) scope(layers ...map[string]interface{}) map[string]interface{} {
+	e.lock.Lock()
+	result := make(map[string]interface{}, len(e.variables))
+	for k, v := range e.variables {
+		result[k] = v
+	}
+	e.lock.Unlock()
+	for _, layer := range layers {
+		for k, v := range layer {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// declareDefaults - sets parameter defaults and evaluates the pipeline variables
+// without overwriting variables of the job
+// a variable which only consists of a single `{{ expression }}` keeps the type of the expression, all others are strings
+func (e *ExecutionContext) declareDefaults(ctx context.Context, parameters []pipeline.Parameter, variables []pipeline.Variable) error {
+	for _, p := range parameters {
+		if _, ok := e.variables[p.Name]; !ok && p.Default != nil {
+			e.variables[p.Name] = p.Default
+		}
+	}
+
+	for _, v := range variables {
+		if _, ok := e.variables[v.Name]; ok {
+			continue
+		}
+		value, err := e.typedValue(ctx, nil, v.Templates, v.Value, e.variables)
+		if err != nil {
+			return fmt.Errorf("unable to evaluate variable `%s`: %w", v.Name, err)
+		}
+		e.variables[v.Name] = value
+	}
+	return nil
+}
+
+// declare - evaluates the variables on top of the given layers
+// each variable can reference the variables declared before it, task is nil for the variables of a stage
+func (e *ExecutionContext) declare(ctx context.Context, task *pipeline.Task, variables []pipeline.Variable, layers ...map[string]interface{}) (map[string]interface{}, error) {
+	result := make(map[string]interface{})
+	for _, v := range variables {
+		value, err := e.typedValue(ctx, task, v.Templates, v.Value, e.scope(append(layers, result)...))
+		if err != nil {
+			return nil, fmt.Errorf("unable to evaluate variable `%s`: %w", v.Name, err)
+		}
+		result[v.Name] = value
+	}
+	return result, nil
+}
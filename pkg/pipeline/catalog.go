@@ -0,0 +1,43 @@
+package pipeline
+
+// Service - Describes a service which tasks can be dispatched to
+type Service struct {
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+	// input a plain string is assigned to, e.g. `shell: ls` or `input: ls` runs the shell with `cmd: ls`
+	Input string `json:"input,omitempty" yaml:"input,omitempty"`
+}
+
+// ServiceCatalog - List of all services which are available to pipelines
+type ServiceCatalog struct {
+	Services []Service `json:"services" yaml:"services"`
+}
+
+// DefaultServiceCatalog - the services provided by the task runners of this repository
+var DefaultServiceCatalog = ServiceCatalog{
+	Services: []Service{
+		{Name: "shell", Description: "runs a shell command", Input: "cmd"},
+		{Name: "file_copy", Description: "copies a file between storages"},
+		{Name: "ffprobe", Description: "probes a media file with ffprobe", Input: "source"},
+		{Name: "ffmpeg", Description: "transcodes a media file with ffmpeg"},
+	},
+}
+
+// Service - returns the service with the given name or nil
+func (c *ServiceCatalog) Service(name string) *Service {
+	for i := range c.Services {
+		if c.Services[i].Name == name {
+			return &c.Services[i]
+		}
+	}
+	return nil
+}
+
+// ServiceNames - returns the names of all services in the catalog
+func (c *ServiceCatalog) ServiceNames() []string {
+	names := make([]string, len(c.Services))
+	for i, service := range c.Services {
+		names[i] = service.Name
+	}
+	return names
+}
@@ -0,0 +1,253 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/d5/tengo/v2"
+	"github.com/d5/tengo/v2/parser"
+	"github.com/d5/tengo/v2/token"
+)
+
+// tengo reports unknown variables as compile errors
+var unresolvedReference = regexp.MustCompile(`unresolved reference '(.*?)'`)
+
+// programs - the programs which have been compiled while parsing or compiling a single pipeline, keyed by their script
+type programs map[string]*program
+
+// program - a compiled expression, programs are immutable and can be evaluated concurrently
+type program struct {
+	bytecode  *tengo.Bytecode
+	globals   []tengo.Object // functions and modules, variables are bound on every evaluation
+	indexes   map[string]int // index of every global which can be replaced by a variable
+	variables []string       // names the expression references which have to be bound to a variable
+	host      []string       // functions the expression references which read from the host, e.g. `env`
+	out       int            // index of the result
+	constants int            // amount of constant objects, checked against the limits on every evaluation
+}
+
+// compile - returns the program of the script, each script is only compiled once per cache
+func (c programs) compile(script string) (*program, error) {
+	if p, ok := c[script]; ok {
+		return p, nil
+	}
+
+	p, err := compileProgram(script)
+	if err != nil {
+		return nil, err
+	}
+	c[script] = p
+	return p, nil
+}
+
+// compileProgram - compiles the script, every unresolved reference is declared as a variable
+// and the script is compiled again until all references resolve
+func compileProgram(script string) (*program, error) {
+	var variables []string
+	for {
+		p, err := compileWith(script, variables)
+		if err == nil {
+			return p, nil
+		}
+		m := unresolvedReference.FindStringSubmatch(err.Error())
+		if m == nil || contains(variables, m[1]) {
+			return nil, err
+		}
+		variables = append(variables, m[1])
+	}
+}
+
+func compileWith(script string, variables []string) (*program, error) {
+	src := []byte(`out := ` + script)
+	fileSet := parser.NewFileSet()
+	file, err := parser.NewParser(fileSet.AddFile("(main)", -1, len(src)), src, nil).ParseFile()
+	if err != nil {
+		return nil, err
+	}
+
+	symbols := tengo.NewSymbolTable()
+	for i, fn := range tengo.GetAllBuiltinFunctions() {
+		symbols.DefineBuiltin(i, fn.Name)
+	}
+
+	// functions and modules are declared in a stable order so their indexes do not depend on map iteration
+	values := globals()
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	objects := make([]tengo.Object, tengo.GlobalsSize)
+	indexes := make(map[string]int, len(names)+len(variables))
+	for _, name := range names {
+		symbol := symbols.Define(name)
+		objects[symbol.Index] = values[name]
+		indexes[name] = symbol.Index
+	}
+	for _, name := range variables {
+		indexes[name] = symbols.Define(name).Index
+	}
+
+	c := tengo.NewCompiler(file.InputFile, symbols, nil, modules(), nil)
+	if err := c.Compile(file); err != nil {
+		return nil, err
+	}
+	out, _, _ := symbols.Resolve("out", false)
+
+	bytecode := c.Bytecode()
+	bytecode.RemoveDuplicates()
+	return &program{
+		bytecode:  bytecode,
+		globals:   objects[:symbols.MaxSymbols()+1],
+		indexes:   indexes,
+		variables: variables,
+		host:      hostReferences(script),
+		out:       out.Index,
+		constants: bytecode.CountObjects(),
+	}, nil
+}
+
+// identifiers - returns all identifiers the script references, selectors like `.output` are skipped
+func identifiers(script string) []string {
+	src := []byte(script)
+	file := parser.NewFileSet().AddFile("", -1, len(src))
+	scanner := parser.NewScanner(file, src, func(parser.SourceFilePos, string) {}, 0)
+
+	var result []string
+	prev := token.Illegal
+	for {
+		tok, literal, _ := scanner.Scan()
+		if tok == token.EOF {
+			return result
+		}
+		if tok == token.Ident && prev != token.Period && !contains(result, literal) {
+			result = append(result, literal)
+		}
+		prev = tok
+	}
+}
+
+// hostReferences - returns the functions with access to the host the script references
+func hostReferences(script string) []string {
+	var result []string
+	for _, name := range identifiers(script) {
+		if contains(hostFunctions, name) {
+			result = append(result, name)
+		}
+	}
+	return result
+}
+
+// compileError - returns the first line of a compile error, the position is relative to the generated script
+func compileError(err error) string {
+	var exprErr *ExpressionError
+	if errors.As(err, &exprErr) {
+		err = exprErr.Err
+	}
+	return strings.SplitN(err.Error(), "\n", 2)[0]
+}
+
+// run - binds the variables and runs the program within the limits, the run is aborted once ctx is done
+func (p *program) run(ctx context.Context, limits *ExpressionLimits, variables map[string]interface{}) (tengo.Object, error) {
+	if limits.MaxConstObjects > 0 && p.constants > limits.MaxConstObjects {
+		return nil, fmt.Errorf("%w: exceeding constant objects limit: %d", ErrExpressionLimit, p.constants)
+	}
+
+	globals := make([]tengo.Object, len(p.globals))
+	copy(globals, p.globals)
+	for _, name := range p.variables {
+		if _, ok := variables[name]; !ok {
+			return nil, fmt.Errorf("unknown variable `%s`", name)
+		}
+	}
+	// variables shadow functions and modules of the same name
+	for name, index := range p.indexes {
+		value, ok := variables[name]
+		if !ok {
+			continue
+		}
+		obj, err := tengo.FromInterface(value)
+		if err != nil {
+			return nil, fmt.Errorf("variable `%s`: %w", name, err)
+		}
+		globals[index] = obj
+	}
+
+	maxAllocs := int64(-1)
+	if limits.MaxAllocs > 0 {
+		maxAllocs = limits.MaxAllocs
+	}
+	vm := tengo.NewVM(p.bytecode, globals, maxAllocs)
+
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("%v", r)
+			}
+		}()
+		done <- vm.Run()
+	}()
+
+	select {
+	case <-ctx.Done():
+		vm.Abort()
+		<-done
+		return nil, ctx.Err()
+	case err := <-done:
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	out := globals[p.out]
+	if out == nil {
+		return tengo.UndefinedValue, nil
+	}
+	// tengo only checks the process wide limit of LimitStrings while the program runs, the limit of the job is checked on the result
+	if limits.MaxStringLen > 0 {
+		if err := checkStringLen(out, limits.MaxStringLen); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// checkStringLen - checks the length of all strings and byte arrays of the result, including those in arrays and maps
+func checkStringLen(obj tengo.Object, limit int) error {
+	var values []tengo.Object
+	switch o := obj.(type) {
+	case *tengo.String:
+		if len(o.Value) > limit {
+			return tengo.ErrStringLimit
+		}
+	case *tengo.Bytes:
+		if len(o.Value) > limit {
+			return tengo.ErrBytesLimit
+		}
+	case *tengo.Array:
+		values = o.Value
+	case *tengo.ImmutableArray:
+		values = o.Value
+	case *tengo.Map:
+		for _, v := range o.Value {
+			values = append(values, v)
+		}
+	case *tengo.ImmutableMap:
+		for _, v := range o.Value {
+			values = append(values, v)
+		}
+	}
+
+	for _, v := range values {
+		if err := checkStringLen(v, limit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package pipeline
+
+import (
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// checkDependencies - reports unknown, ambiguous and cyclic `depends_on` references within a stage
+func (d *decoder) checkDependencies(stage *Stage, dependsOn []nodeRef) {
+	valid := true
+	for i, task := range stage.Tasks {
+		for _, name := range task.DependsOn {
+			ref := dependsOn[i]
+			indices := stage.TaskIndices(name)
+			switch {
+			case len(indices) == 0:
+				ref.decoder.errorf(entryNode(ref.node, name), "unknown task `%s` in depends_on", name)
+				valid = false
+			case len(indices) > 1 && !stage.expansions(indices):
+				ref.decoder.errorf(entryNode(ref.node, name), "task name `%s` in depends_on is ambiguous", name)
+				valid = false
+			case name == task.Name:
+				ref.decoder.errorf(entryNode(ref.node, name), "task `%s` cannot depend on itself", name)
+				valid = false
+			}
+		}
+	}
+	if !valid {
+		return
+	}
+
+	// depth first search for cycles, each cycle is only reported once
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(stage.Tasks))
+	var path []int
+	var visit func(i int) bool
+	visit = func(i int) bool {
+		state[i] = visiting
+		path = append(path, i)
+		for _, name := range stage.Tasks[i].DependsOn {
+			for _, j := range stage.TaskIndices(name) {
+				if state[j] == visiting {
+					var names []string
+					for _, p := range path[indexOf(path, j):] {
+						names = append(names, stage.Tasks[p].Name)
+					}
+					ref := dependsOn[i]
+					ref.decoder.errorf(entryNode(ref.node, name), "dependency cycle detected: %s -> %s", strings.Join(names, " -> "), name)
+					return false
+				}
+				if state[j] == unvisited && !visit(j) {
+					return false
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = visited
+		return true
+	}
+	for i := range stage.Tasks {
+		if state[i] == unvisited {
+			path = nil
+			if !visit(i) {
+				// do not report the same cycle again
+				for j := range state {
+					if state[j] == visiting {
+						state[j] = visited
+					}
+				}
+			}
+		}
+	}
+}
+
+// TaskIndices - returns the indices of all tasks with the given name
+func (s *Stage) TaskIndices(name string) []int {
+	var result []int
+	for i, task := range s.Tasks {
+		if task.Name == name {
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+// expansions - checks if all tasks are combinations of a `matrix`
+// depending on a matrix task waits for all of its combinations
+func (s *Stage) expansions(indices []int) bool {
+	for _, i := range indices {
+		if s.Tasks[i].Matrix == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// entryNode - returns the entry of a string or string list node with the given value
+func entryNode(node *yaml.Node, value string) *yaml.Node {
+	node = resolve(node)
+	for _, entry := range node.Content {
+		if entry = resolve(entry); entry.Value == value {
+			return entry
+		}
+	}
+	return node
+}
+
+func indexOf(list []int, value int) int {
+	for i, entry := range list {
+		if entry == value {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,56 @@
+package pipeline
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDependsOn(t *testing.T) {
+	p, err := CreateFromBytes(`---
+stages:
+- stage: s
+  parallel: true
+  tasks:
+  - name: probe
+    service: shell
+  - name: encode
+    service: shell
+    depends_on: probe
+  - name: upload
+    service: shell
+    depends_on: [probe, encode]
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	stage := p.Stages[0]
+	if stage.FailurePolicy != FailureCancel {
+		t.Errorf("failure_policy defaults to %q, expected %q", stage.FailurePolicy, FailureCancel)
+	}
+	if deps := stage.Tasks[2].DependsOn; !reflect.DeepEqual(deps, []string{"probe", "encode"}) {
+		t.Errorf("depends_on = %v", deps)
+	}
+	if indices := stage.TaskIndices("encode"); !reflect.DeepEqual(indices, []int{1}) {
+		t.Errorf("encode resolves to %v, expected [1]", indices)
+	}
+}
+
+func TestInvalidDependencies(t *testing.T) {
+	tasks := []struct {
+		tasks string
+		error string
+	}{
+		{"  - {name: a, service: shell, depends_on: b}\n", "5:43: unknown task `b` in depends_on"},
+		{"  - {name: a, service: shell, depends_on: a}\n", "5:43: task `a` cannot depend on itself"},
+		{"  - {name: a, service: shell}\n  - {name: a, service: shell}\n  - {name: b, service: shell, depends_on: a}\n", "task name `a` in depends_on is ambiguous"},
+		{"  - {name: a, service: shell, depends_on: c}\n  - {name: b, service: shell, depends_on: a}\n  - {name: c, service: shell, depends_on: b}\n", "dependency cycle detected: a -> c -> b -> a"},
+	}
+	for _, tt := range tasks {
+		_, err := CreateFromBytes("---\nstages:\n- stage: s\n  tasks:\n" + tt.tasks)
+		if err == nil || !strings.Contains(err.Error(), tt.error) {
+			t.Errorf("error = %v, expected %q for\n%s", err, tt.error, tt.tasks)
+		}
+	}
+}
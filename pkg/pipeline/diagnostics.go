@@ -0,0 +1,99 @@
+package pipeline
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Severity - Describes how severe a diagnostic is
+type Severity string
+
+const (
+	// SeverityError - the pipeline is invalid or will fail when it is executed
+	SeverityError Severity = "error"
+	// SeverityWarning - the pipeline is valid but probably does not do what was intended
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic - Describes a single problem found while parsing or linting a pipeline
+type Diagnostic struct {
+	File     string   `json:"file,omitempty"`
+	Line     int      `json:"line"`
+	Column   int      `json:"column"`
+	Severity Severity `json:"severity"`
+	Message  string   `json:"message"`
+}
+
+// String - formats the diagnostic as `file:line:column: message`
+// the position is omitted if it is unknown and warnings are prefixed with `warning:`
+func (d Diagnostic) String() string {
+	var pos []string
+	if d.File != "" {
+		pos = append(pos, d.File)
+	}
+	if d.Line > 0 {
+		pos = append(pos, strconv.Itoa(d.Line), strconv.Itoa(d.Column))
+	}
+	msg := d.Message
+	if d.Severity == SeverityWarning {
+		msg = "warning: " + msg
+	}
+	if len(pos) == 0 {
+		return msg
+	}
+	return strings.Join(pos, ":") + ": " + msg
+}
+
+// Diagnostics - List of all problems found while parsing a pipeline
+type Diagnostics []Diagnostic
+
+// Error - joins all diagnostics into a single error message
+func (d Diagnostics) Error() string {
+	lines := make([]string, len(d))
+	for i, diag := range d {
+		lines[i] = diag.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// HasErrors - checks if any of the diagnostics is an error
+func (d Diagnostics) HasErrors() bool {
+	for _, diag := range d {
+		if diag.Severity != SeverityWarning {
+			return true
+		}
+	}
+	return false
+}
+
+// yaml.v3 only reports syntax errors as plain strings
+var yamlErrorLine = regexp.MustCompile(`^yaml: line (\d+): (.*)$`)
+
+func newDiagnostic(severity Severity, format string, args ...interface{}) Diagnostic {
+	return Diagnostic{
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+func (d *decoder) errorf(node *yaml.Node, format string, args ...interface{}) {
+	diag := newDiagnostic(SeverityError, format, args...)
+	diag.File = d.file
+	diag.Line = node.Line
+	diag.Column = node.Column
+	d.diags = append(d.diags, diag)
+}
+
+func (d *decoder) yamlError(err error) {
+	diag := newDiagnostic(SeverityError, "%s", strings.TrimPrefix(err.Error(), "yaml: "))
+	diag.File = d.file
+	if m := yamlErrorLine.FindStringSubmatch(err.Error()); m != nil {
+		diag.Line, _ = strconv.Atoi(m[1])
+		diag.Message = m[2]
+	}
+	d.diags = append(d.diags, diag)
+}
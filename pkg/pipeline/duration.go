@@ -0,0 +1,33 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Duration - A time.Duration which is written as a duration string like `1m30s` in json
+type Duration time.Duration
+
+// String - formats the duration like time.Duration
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// MarshalJSON - writes the duration as a duration string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON - reads the duration from a duration string
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
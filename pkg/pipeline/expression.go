@@ -2,40 +2,200 @@ package pipeline
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
 
 	"github.com/d5/tengo/v2"
 )
 
+var (
+	// ErrExpressionTimeout - the evaluation did not finish within the timeout of the expression limits
+	ErrExpressionTimeout = errors.New("expression exceeded its timeout")
+	// ErrExpressionLimit - the evaluation exceeded the allocation or constant limits of the expression limits
+	ErrExpressionLimit = errors.New("expression exceeded its limits")
+)
+
+// ExpressionLimits - bounds a single evaluation of an expression, a zero value disables the limit
+type ExpressionLimits struct {
+	// time an evaluation is allowed to take
+	Timeout time.Duration `yaml:"timeout" json:"timeout"`
+	// amount of objects an evaluation is allowed to allocate
+	MaxAllocs int64 `yaml:"max_allocs" json:"max_allocs"`
+	// amount of constants an expression is allowed to contain
+	MaxConstObjects int `yaml:"max_const_objects" json:"max_const_objects"`
+	// length in bytes of the strings and byte arrays an evaluation is allowed to result in
+	// strings created while the expression runs are only bounded by the process wide limit of LimitStrings
+	MaxStringLen int `yaml:"max_string_len" json:"max_string_len"`
+}
+
+// DefaultExpressionLimits - the limits used by Evaluate and Value
+var DefaultExpressionLimits = ExpressionLimits{
+	Timeout:         5 * time.Second,
+	MaxAllocs:       100000,
+	MaxConstObjects: 1000,
+	MaxStringLen:    4 << 20,
+}
+
+// LimitStrings - bounds the length in bytes of every string and byte array any expression creates, a zero value removes the limit
+// unlike ExpressionLimits the limit is global to the process, tengo checks it before a string is allocated.
+// it has to be set once at startup before any expression is evaluated
+func LimitStrings(limit int) {
+	if limit <= 0 {
+		limit = math.MaxInt32
+	}
+	tengo.MaxStringLen = limit
+	tengo.MaxBytesLen = limit
+}
+
+// ExpressionError - returned when an expression could not be compiled or evaluated
+type ExpressionError struct {
+	Script string
+	Task   string // name of the task the expression belongs to, empty if it is not part of a task
+	Err    error
+}
+
+func (e *ExpressionError) Error() string {
+	msg := "unable to evaluate expression `" + e.Script + "`"
+	if e.Task != "" {
+		msg += " of task `" + e.Task + "`"
+	}
+	return msg + ": " + e.Err.Error()
+}
+
+func (e *ExpressionError) Unwrap() error {
+	return e.Err
+}
+
 // Expression - Describes a expression which evaluates to a bool
 type Expression struct {
 	Script string
+
+	program *program // set by Compile, expressions which have not been compiled are compiled on every evaluation
+}
+
+// Compile - compiles the expression so it is only bound to the variables when it is evaluated
+// variables the expression references are resolved on evaluation, compile errors are syntax errors or invalid statements
+func (e *Expression) Compile() error {
+	return e.compile(make(programs))
+}
+
+// compile - compiles the expression with the programs of the cache
+func (e *Expression) compile(cache programs) error {
+	p, err := cache.compile(e.Script)
+	if err != nil {
+		return &ExpressionError{
+			Script: e.Script,
+			Err:    err,
+		}
+	}
+	e.program = p
+	return nil
+}
+
+// HostFunctions - returns the names of the functions with access to the host the expression references, e.g. `env`
+// a variable of the same name shadows the function when the expression is evaluated
+func (e *Expression) HostFunctions() ([]string, error) {
+	p, err := e.compiled()
+	if err != nil {
+		return nil, err
+	}
+	return p.host, nil
+}
+
+// Variables - returns the names of the variables the expression references, functions and modules are not included
+func (e *Expression) Variables() ([]string, error) {
+	p, err := e.compiled()
+	if err != nil {
+		return nil, err
+	}
+	return p.variables, nil
+}
+
+// compiled - returns the program of the expression, an expression which has not been compiled is compiled again
+func (e *Expression) compiled() (*program, error) {
+	if e.program != nil {
+		return e.program, nil
+	}
+	p, err := compileProgram(e.Script)
+	if err != nil {
+		return nil, &ExpressionError{
+			Script: e.Script,
+			Err:    err,
+		}
+	}
+	return p, nil
 }
 
 // Evaluate - Evaluates the expression to a bool
 func (e *Expression) Evaluate(variables map[string]interface{}) (string, error) {
-	// TODO: handle errors
-	src := `out := ` + e.Script
-	script := tengo.NewScript([]byte(src))
+	return e.EvaluateContext(context.Background(), &DefaultExpressionLimits, variables)
+}
+
+// EvaluateContext - Evaluates the expression within the limits, the evaluation is aborted once ctx is done
+func (e *Expression) EvaluateContext(ctx context.Context, limits *ExpressionLimits, variables map[string]interface{}) (string, error) {
+	out, err := e.run(ctx, limits, variables)
+	if err != nil {
+		return "", err
+	}
+	s, _ := tengo.ToString(out)
+	return s, nil
+}
 
-	// setup additional helper functions
-	for k, v := range userFunctions {
-		_ = script.Add(k, &tengo.UserFunction{
-			Value: v,
-		})
+// Value - Evaluates the expression and returns the result as a go value
+func (e *Expression) Value(variables map[string]interface{}) (interface{}, error) {
+	return e.ValueContext(context.Background(), &DefaultExpressionLimits, variables)
+}
+
+// ValueContext - Evaluates the expression within the limits and returns the result as a go value
+func (e *Expression) ValueContext(ctx context.Context, limits *ExpressionLimits, variables map[string]interface{}) (interface{}, error) {
+	out, err := e.run(ctx, limits, variables)
+	if err != nil {
+		return nil, err
 	}
+	return tengo.ToInterface(out), nil
+}
 
-	// setup variables
-	for k, v := range variables {
-		_ = script.Add(k, v)
+func (e *Expression) run(ctx context.Context, limits *ExpressionLimits, variables map[string]interface{}) (tengo.Object, error) {
+	p := e.program
+	if p == nil {
+		var err error
+		p, err = compileProgram(e.Script)
+		if err != nil {
+			return nil, e.failure(ctx, err)
+		}
 	}
 
-	// compile script
-	compiled, err := script.RunContext(context.Background())
+	evalCtx := ctx
+	if limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		evalCtx, cancel = context.WithTimeout(ctx, limits.Timeout)
+		defer cancel()
+	}
+
+	out, err := p.run(evalCtx, limits, variables)
 	if err != nil {
-		return "", err
+		return nil, e.failure(ctx, err)
 	}
+	return out, nil
+}
 
-	// evaluate output
-	out := compiled.Get("out")
-	return out.String(), nil
+// failure - wraps the error of tengo into an ExpressionError
+// exceeded limits are reported as ErrExpressionTimeout or ErrExpressionLimit, a cancelled ctx is returned as is
+func (e *Expression) failure(ctx context.Context, err error) error {
+	switch {
+	case ctx.Err() != nil:
+		err = ctx.Err()
+	case errors.Is(err, context.DeadlineExceeded):
+		err = ErrExpressionTimeout
+	case errors.Is(err, tengo.ErrObjectAllocLimit):
+		err = fmt.Errorf("%w: %s", ErrExpressionLimit, tengo.ErrObjectAllocLimit)
+	case errors.Is(err, tengo.ErrStringLimit), errors.Is(err, tengo.ErrBytesLimit):
+		err = fmt.Errorf("%w: %s", ErrExpressionLimit, err)
+	}
+	return &ExpressionError{
+		Script: e.Script,
+		Err:    err,
+	}
 }
@@ -0,0 +1,100 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+const endless = `func() { for {} }()`
+
+func TestExpressionTimeout(t *testing.T) {
+	limits := ExpressionLimits{Timeout: 20 * time.Millisecond}
+
+	start := time.Now()
+	_, err := (&Expression{Script: endless}).ValueContext(context.Background(), &limits, map[string]interface{}{})
+	if !errors.Is(err, ErrExpressionTimeout) {
+		t.Errorf("error = %v, expected a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("evaluation has been stopped after %s", elapsed)
+	}
+
+	var exprErr *ExpressionError
+	if !errors.As(err, &exprErr) || exprErr.Script != endless {
+		t.Errorf("error = %v, expected an ExpressionError of the script", err)
+	}
+}
+
+func TestExpressionCancelled(t *testing.T) {
+	// a cancelled job is not reported as a timeout of the expression
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	_, err := (&Expression{Script: endless}).ValueContext(ctx, &ExpressionLimits{}, map[string]interface{}{})
+	if !errors.Is(err, context.Canceled) || errors.Is(err, ErrExpressionTimeout) {
+		t.Errorf("error = %v, expected the cancellation of the context", err)
+	}
+}
+
+func TestExpressionAllocationLimits(t *testing.T) {
+	appending := `func() { a := []; for i := 0; i < 1000; i++ { a = append(a, [i]) }; return len(a) }()`
+
+	_, err := (&Expression{Script: appending}).ValueContext(context.Background(), &ExpressionLimits{MaxAllocs: 100}, map[string]interface{}{})
+	if !errors.Is(err, ErrExpressionLimit) {
+		t.Errorf("allocations: error = %v, expected the limit to be exceeded", err)
+	}
+
+	_, err = (&Expression{Script: `[1, 2, 3, 4, 5]`}).ValueContext(context.Background(), &ExpressionLimits{MaxConstObjects: 2}, map[string]interface{}{})
+	if !errors.Is(err, ErrExpressionLimit) {
+		t.Errorf("constants: error = %v, expected the limit to be exceeded", err)
+	}
+
+	// the defaults are generous enough for regular expressions
+	if result, err := (&Expression{Script: appending}).Value(map[string]interface{}{}); err != nil || result != int64(1000) {
+		t.Errorf("%s = %v (%v) with the default limits", appending, result, err)
+	}
+}
+
+func TestExpressionStringLimit(t *testing.T) {
+	limits := ExpressionLimits{MaxStringLen: 1024}
+	exceeding := []string{
+		`text.repeat("a", 2048)`,
+		`text.repeat("a", 1024) + "b"`,
+		`bytes(2048)`,
+		`[1, [text.repeat("a", 2048)]]`,
+		`{result: {value: bytes(2048)}}`,
+	}
+	for _, script := range exceeding {
+		_, err := (&Expression{Script: script}).ValueContext(context.Background(), &limits, map[string]interface{}{})
+		if !errors.Is(err, ErrExpressionLimit) {
+			t.Errorf("%s: error = %v, expected the string limit to be exceeded", script, err)
+		}
+	}
+
+	if result, err := (&Expression{Script: `len(text.repeat("a", 1024))`}).ValueContext(context.Background(), &limits, map[string]interface{}{}); err != nil || result != int64(1024) {
+		t.Errorf("a string of the maximum length = %v (%v)", result, err)
+	}
+
+	// the default limit stops expressions before they exhaust the memory of the executor
+	if _, err := (&Expression{Script: `text.repeat("a", 5 << 20)`}).Value(map[string]interface{}{}); !errors.Is(err, ErrExpressionLimit) {
+		t.Errorf("error = %v, expected the default string limit to be exceeded", err)
+	}
+}
+
+func TestLimitStrings(t *testing.T) {
+	LimitStrings(1024)
+	t.Cleanup(func() { LimitStrings(0) })
+
+	// the process wide limit stops the allocation itself, even if the result is small
+	script := `len(text.repeat("a", 2048))`
+	if _, err := (&Expression{Script: script}).ValueContext(context.Background(), &ExpressionLimits{}, map[string]interface{}{}); !errors.Is(err, ErrExpressionLimit) {
+		t.Errorf("error = %v, expected the process wide string limit to be exceeded", err)
+	}
+
+	LimitStrings(0)
+	if result, err := (&Expression{Script: script}).ValueContext(context.Background(), &ExpressionLimits{}, map[string]interface{}{}); err != nil || result != int64(2048) {
+		t.Errorf("without a process wide limit = %v (%v)", result, err)
+	}
+}
@@ -0,0 +1,641 @@
+package pipeline
+
+import (
+	"bytes"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// order of the keys in the canonical format is the order of the properties in the schema,
+// unknown keys follow in the order they have been written
+var (
+	pipelineKeys  = parserSchema.Keys("pipeline")
+	stageKeys     = parserSchema.Keys("stage")
+	taskKeys      = parserSchema.Keys("task")
+	parameterKeys = parserSchema.Keys("parameter")
+)
+
+// booleans and integers are written with their type, even if they have been quoted
+var (
+	pipelineProperties  = parserSchema.properties("pipeline")
+	stageProperties     = parserSchema.properties("stage")
+	taskProperties      = parserSchema.properties("task")
+	parameterProperties = parserSchema.properties("parameter")
+)
+
+// Marshal - writes the pipeline as a canonical pipeline script
+// services and sub-pipelines without inputs as well as plain string parameters use their short form,
+// references have already been resolved by the parser, sub-pipelines are referenced by their key in `Pipelines`
+func Marshal(p *Pipeline) ([]byte, error) {
+	node, err := marshalPipeline(p)
+	if err != nil {
+		return nil, err
+	}
+	return encode(node)
+}
+
+// Format - formats the pipeline script canonically, the script has to be a valid pipeline
+// unlike Marshal the script is formatted as it is written, `include` and `import` references as well as comments are kept
+func Format(file string, script string, loader Loader) ([]byte, error) {
+	return NewParser().
+		Loader(loader).
+		Format(file, script)
+}
+
+// Format - formats the pipeline script canonically after it has been parsed with the loader and catalog of the parser
+func (p *Parser) Format(file string, script string) ([]byte, error) {
+	_, err := p.Parse(file, script)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(script), &doc); err != nil {
+		return nil, err
+	}
+	node := doc.Content[0]
+	normalize(node)
+	formatPipeline(node)
+	return encode(node)
+}
+
+// Equivalent - checks if both pipelines and all of their sub-pipelines have the same canonical form
+func Equivalent(a *Pipeline, b *Pipeline) bool {
+	if len(a.Pipelines) != len(b.Pipelines) {
+		return false
+	}
+	for key, sub := range a.Pipelines {
+		other, ok := b.Pipelines[key]
+		if !ok || !sameCanonical(sub, other) {
+			return false
+		}
+	}
+	return sameCanonical(a, b)
+}
+
+func sameCanonical(a *Pipeline, b *Pipeline) bool {
+	ca, err := Marshal(a)
+	if err != nil {
+		return false
+	}
+	cb, err := Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(ca, cb)
+}
+
+func encode(node *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("---\n")
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(node); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// normalize - writes all collections in block style and lets the encoder decide how to quote scalars
+func normalize(node *yaml.Node) {
+	switch node.Kind {
+	case yaml.ScalarNode:
+		node.Style &^= yaml.DoubleQuotedStyle | yaml.SingleQuotedStyle | yaml.FlowStyle
+	case yaml.MappingNode, yaml.SequenceNode:
+		node.Style &^= yaml.FlowStyle
+	}
+	for _, child := range node.Content {
+		normalize(child)
+	}
+}
+
+func formatPipeline(node *yaml.Node) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+	orderKeys(node, pipelineKeys)
+	retype(node, pipelineProperties)
+	eachValue(node, func(key string, value *yaml.Node) {
+		switch key {
+		case "parameters":
+			eachEntry(value, formatParameter)
+		case "stages":
+			eachEntry(value, formatStage)
+		case "handlers", "on_failure", "always":
+			eachEntry(value, formatTask)
+		}
+	})
+}
+
+func formatStage(node *yaml.Node) {
+	if node.Kind != yaml.MappingNode || reference(node, "include") != nil || reference(node, "import") != nil {
+		return
+	}
+	orderKeys(node, stageKeys)
+	retype(node, stageProperties)
+	eachValue(node, func(key string, value *yaml.Node) {
+		switch key {
+		case "tasks", "on_failure", "always":
+			eachEntry(value, formatTask)
+		}
+	})
+}
+
+func formatTask(node *yaml.Node) {
+	if node.Kind != yaml.MappingNode || reference(node, "include") != nil {
+		return
+	}
+	// services used as keys are written where `service` would be
+	rank := func(key string) int {
+		if i := indexOfKey(taskKeys, key); i >= 0 {
+			return i
+		}
+		return indexOfKey(taskKeys, "service")
+	}
+	orderBy(node, rank)
+	retype(node, taskProperties)
+	eachValue(node, func(key string, value *yaml.Node) {
+		switch key {
+		case "service", "pipeline":
+			formatCall(value)
+		case string(AssertTask):
+			orderKeys(value, []string{"that", "message"})
+		case string(FailTask):
+			if message := reference(value, "message"); message != nil && message.Kind == yaml.ScalarNode {
+				shorten(value, message)
+			}
+		}
+	})
+}
+
+// formatCall - writes a service or sub-pipeline with `name` first and its inputs sorted,
+// calls without inputs are shortened to the name
+func formatCall(node *yaml.Node) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+	if name := reference(node, "name"); name != nil && name.Kind == yaml.ScalarNode {
+		shorten(node, name)
+		return
+	}
+	orderKeys(node, []string{"name"})
+	sortKeys(node, 2)
+}
+
+// formatParameter - shortens parameters which only consist of a name
+func formatParameter(node *yaml.Node) {
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+	if name := reference(node, "name"); name != nil && name.Kind == yaml.ScalarNode {
+		shorten(node, name)
+		return
+	}
+	orderKeys(node, parameterKeys)
+	retype(node, parameterProperties)
+}
+
+// retype - writes the values of boolean and integer properties with their type,
+// quoted values and other notations like `True` or `0x10` are converted to `true` and `16`
+func retype(node *yaml.Node, properties map[string]*Schema) {
+	eachValue(node, func(key string, value *yaml.Node) {
+		prop, ok := properties[key]
+		if !ok || value.Kind != yaml.ScalarNode {
+			return
+		}
+		switch {
+		case prop.quoted(boolPattern):
+			switch strings.ToLower(value.Value) {
+			case "true", "false":
+				value.Tag, value.Value = "!!bool", strings.ToLower(value.Value)
+			}
+
+		case prop.quoted(intPattern):
+			var i int
+			if value.Tag == "!!str" {
+				var err error
+				if i, err = strconv.Atoi(value.Value); err != nil {
+					return
+				}
+			} else if value.Tag != "!!int" || value.Decode(&i) != nil {
+				return
+			}
+			value.Tag, value.Value = "!!int", strconv.Itoa(i)
+		}
+	})
+}
+
+// shorten - replaces the mapping with the scalar value, comments of the mapping are kept
+func shorten(node *yaml.Node, value *yaml.Node) {
+	head, line, foot := node.HeadComment, node.LineComment, node.FootComment
+	*node = *value
+	node.HeadComment, node.LineComment, node.FootComment = head, line, foot
+}
+
+// orderKeys - sorts the entries of the mapping by the position of their key in keys
+// unknown keys are moved to the end and keep their order
+func orderKeys(node *yaml.Node, keys []string) {
+	orderBy(node, func(key string) int {
+		if i := indexOfKey(keys, key); i >= 0 {
+			return i
+		}
+		return len(keys)
+	})
+}
+
+// orderBy - sorts the entries of the mapping by the rank of their key, entries of the same rank keep their order
+func orderBy(node *yaml.Node, rank func(key string) int) {
+	pairs := mappingPairs(node)
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return rank(pairs[i][0].Value) < rank(pairs[j][0].Value)
+	})
+	setPairs(node, pairs)
+}
+
+// indexOfKey - the position of the key in keys or -1
+func indexOfKey(keys []string, key string) int {
+	for i, k := range keys {
+		if k == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// sortKeys - sorts the entries of the mapping starting at the given content index by their key
+func sortKeys(node *yaml.Node, start int) {
+	if start >= len(node.Content) {
+		return
+	}
+	rest := &yaml.Node{Content: node.Content[start:]}
+	pairs := mappingPairs(rest)
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i][0].Value < pairs[j][0].Value
+	})
+	setPairs(rest, pairs)
+}
+
+func mappingPairs(node *yaml.Node) [][2]*yaml.Node {
+	pairs := make([][2]*yaml.Node, 0, len(node.Content)/2)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		pairs = append(pairs, [2]*yaml.Node{node.Content[i], node.Content[i+1]})
+	}
+	return pairs
+}
+
+func setPairs(node *yaml.Node, pairs [][2]*yaml.Node) {
+	for i, pair := range pairs {
+		node.Content[2*i] = pair[0]
+		node.Content[2*i+1] = pair[1]
+	}
+}
+
+func eachValue(node *yaml.Node, fn func(key string, value *yaml.Node)) {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		fn(node.Content[i].Value, node.Content[i+1])
+	}
+}
+
+func eachEntry(node *yaml.Node, fn func(*yaml.Node)) {
+	if node.Kind != yaml.SequenceNode {
+		return
+	}
+	for _, entry := range node.Content {
+		fn(entry)
+	}
+}
+
+func marshalPipeline(p *Pipeline) (*yaml.Node, error) {
+	m := &mapping{}
+	m.str("name", p.Name)
+	if len(p.Parameters) > 0 {
+		params := sequence()
+		for i := range p.Parameters {
+			param, err := marshalParameter(&p.Parameters[i])
+			if err != nil {
+				return nil, err
+			}
+			params.Content = append(params.Content, param)
+		}
+		m.add("parameters", params)
+	}
+	m.vars(p.Variables)
+	if p.Timeout > 0 {
+		m.str("timeout", p.Timeout.String())
+	}
+
+	stages := sequence()
+	for i := range p.Stages {
+		stage, err := marshalStage(&p.Stages[i])
+		if err != nil {
+			return nil, err
+		}
+		stages.Content = append(stages.Content, stage)
+	}
+	m.add("stages", stages)
+
+	if err := m.tasks("handlers", p.Handlers); err != nil {
+		return nil, err
+	}
+	if err := m.tasks("on_failure", p.OnFailure); err != nil {
+		return nil, err
+	}
+	if err := m.tasks("always", p.Always); err != nil {
+		return nil, err
+	}
+	if len(p.Outputs) > 0 {
+		outputs := &mapping{}
+		for _, output := range p.Outputs {
+			outputs.str(output.Name, output.Value.Script)
+		}
+		m.add("outputs", outputs.node())
+	}
+	return m.node(), nil
+}
+
+func marshalParameter(p *Parameter) (*yaml.Node, error) {
+	if p.Type == StringParameter && p.Description == "" && p.Default == nil && !p.Required && len(p.Enum) == 0 && p.Pattern == "" {
+		return scalar(p.Name), nil
+	}
+
+	m := &mapping{}
+	m.str("name", p.Name)
+	m.str("type", string(p.Type))
+	m.str("description", p.Description)
+	if err := m.value("default", p.Default); err != nil {
+		return nil, err
+	}
+	m.flag("required", p.Required)
+	if len(p.Enum) > 0 {
+		if err := m.value("enum", p.Enum); err != nil {
+			return nil, err
+		}
+	}
+	m.str("pattern", p.Pattern)
+	return m.node(), nil
+}
+
+func marshalStage(s *Stage) (*yaml.Node, error) {
+	m := &mapping{}
+	m.add("stage", scalar(s.Name))
+	if err := m.matrix(s.Matrix); err != nil {
+		return nil, err
+	}
+	m.vars(s.Variables)
+	m.str("when", s.When.Script)
+	m.str("until", s.Until.Script)
+	m.int("max_iterations", s.MaxIterations)
+	if s.Delay > 0 {
+		m.str("delay", s.Delay.String())
+	}
+	m.flag("parallel", s.Parallel)
+	m.int("max_parallel", s.MaxParallel)
+	if s.FailurePolicy != "" && s.FailurePolicy != FailureCancel {
+		m.str("failure_policy", string(s.FailurePolicy))
+	}
+	m.flag("flush_handlers", s.FlushHandlers)
+	if err := m.tasks("tasks", s.Tasks); err != nil {
+		return nil, err
+	}
+	if err := m.tasks("on_failure", s.OnFailure); err != nil {
+		return nil, err
+	}
+	if err := m.tasks("always", s.Always); err != nil {
+		return nil, err
+	}
+	return m.node(), nil
+}
+
+func marshalTask(t *Task) (*yaml.Node, error) {
+	m := &mapping{}
+	m.str("name", t.Name)
+
+	if t.Local != "" {
+		m.add(string(t.Local), marshalLocal(t))
+	} else {
+		key, name := "service", t.Service
+		if t.Pipeline != "" {
+			key, name = "pipeline", t.Pipeline
+		}
+		call, err := marshalCall(name, t.Parameters)
+		if err != nil {
+			return nil, err
+		}
+		m.add(key, call)
+	}
+
+	m.str("when", t.When.Script)
+	if t.Items != nil {
+		if err := m.value("with_items", t.Items); err != nil {
+			return nil, err
+		}
+	} else {
+		m.str("loop", t.Loop.Script)
+	}
+	if err := m.matrix(t.Matrix); err != nil {
+		return nil, err
+	}
+	m.vars(t.Variables)
+	m.list("depends_on", t.DependsOn)
+	m.str("register", t.Register)
+	m.list("notify", t.Notify)
+	m.flag("ignore_errors", t.IgnoreErrors)
+	if t.Timeout > 0 {
+		m.str("timeout", t.Timeout.String())
+	}
+	if t.Retry.Retries != nil {
+		m.add("retries", &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(*t.Retry.Retries)})
+	}
+	if t.Retry.Delay > 0 {
+		m.str("retry_delay", t.Retry.Delay.String())
+	}
+	if t.Retry.Backoff != "" && t.Retry.Backoff != FixedBackoff {
+		m.str("backoff", string(t.Retry.Backoff))
+	}
+	m.list("retry_on", t.Retry.On)
+	return m.node(), nil
+}
+
+// marshalCall - writes a service or sub-pipeline, calls without inputs are written as their name only
+func marshalCall(name string, inputs map[string]interface{}) (*yaml.Node, error) {
+	if len(inputs) == 0 {
+		return scalar(name), nil
+	}
+
+	m := &mapping{}
+	m.add("name", scalar(name))
+	keys := make([]string, 0, len(inputs))
+	for key := range inputs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := m.value(key, inputs[key]); err != nil {
+			return nil, err
+		}
+	}
+	return m.node(), nil
+}
+
+// marshalLocal - writes the inputs of a local task, `assert` and `fail` use their short form without a message
+func marshalLocal(t *Task) *yaml.Node {
+	switch t.Local {
+	case AssertTask:
+		m := &mapping{}
+		m.list("that", t.Conditions())
+		if t.Message() == "" {
+			return m.content[1]
+		}
+		m.str("message", t.Message())
+		return m.node()
+
+	case FailTask:
+		return scalar(t.Message())
+	}
+
+	facts := &mapping{}
+	keys := make([]string, 0, len(t.Parameters))
+	for key := range t.Parameters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if err := facts.value(key, t.Parameters[key]); err != nil {
+			facts.add(key, scalar(""))
+		}
+	}
+	return facts.node()
+}
+
+// mapping - builds a yaml mapping in the order the entries are added
+type mapping struct {
+	content []*yaml.Node
+}
+
+func (m *mapping) node() *yaml.Node {
+	return &yaml.Node{
+		Kind:    yaml.MappingNode,
+		Tag:     "!!map",
+		Content: m.content,
+	}
+}
+
+func (m *mapping) add(key string, value *yaml.Node) {
+	m.content = append(m.content, scalar(key), value)
+}
+
+// str - adds the string if it is not empty
+func (m *mapping) str(key string, value string) {
+	if value != "" {
+		m.add(key, scalar(value))
+	}
+}
+
+// flag - adds the bool if it is set
+func (m *mapping) flag(key string, value bool) {
+	if value {
+		m.add(key, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: "true"})
+	}
+}
+
+// int - adds the number if it is positive
+func (m *mapping) int(key string, value int) {
+	if value > 0 {
+		m.add(key, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(value)})
+	}
+}
+
+// list - adds the list of strings if it is not empty
+func (m *mapping) list(key string, values []string) {
+	if len(values) == 0 {
+		return
+	}
+	seq := sequence()
+	for _, v := range values {
+		seq.Content = append(seq.Content, scalar(v))
+	}
+	m.add(key, seq)
+}
+
+// value - adds the go value if it is not nil
+func (m *mapping) value(key string, value interface{}) error {
+	if value == nil {
+		return nil
+	}
+	var node yaml.Node
+	if err := node.Encode(value); err != nil {
+		return err
+	}
+	m.add(key, &node)
+	return nil
+}
+
+// vars - adds the variables in the order they have been declared
+func (m *mapping) vars(variables []Variable) {
+	if len(variables) == 0 {
+		return
+	}
+	vars := &mapping{}
+	for _, v := range variables {
+		vars.add(v.Name, scalar(v.Value))
+	}
+	m.add("vars", vars.node())
+}
+
+// matrix - adds the combination of an expanded task or stage as a matrix with a single combination
+func (m *mapping) matrix(combination Matrix) error {
+	if len(combination) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(combination))
+	for key := range combination {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	matrix := &mapping{}
+	for _, key := range keys {
+		if err := matrix.value(key, []interface{}{combination[key]}); err != nil {
+			return err
+		}
+	}
+	m.add("matrix", matrix.node())
+	return nil
+}
+
+// tasks - adds the list of tasks if it is not empty
+func (m *mapping) tasks(key string, tasks []Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+	seq := sequence()
+	for i := range tasks {
+		task, err := marshalTask(&tasks[i])
+		if err != nil {
+			return err
+		}
+		seq.Content = append(seq.Content, task)
+	}
+	m.add(key, seq)
+	return nil
+}
+
+func scalar(value string) *yaml.Node {
+	return &yaml.Node{
+		Kind:  yaml.ScalarNode,
+		Tag:   "!!str",
+		Value: value,
+	}
+}
+
+func sequence() *yaml.Node {
+	return &yaml.Node{
+		Kind: yaml.SequenceNode,
+		Tag:  "!!seq",
+	}
+}
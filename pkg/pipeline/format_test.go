@@ -0,0 +1,189 @@
+package pipeline
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func ExampleFormat() {
+	formatted, err := Format("probe.pipe", `---
+stages:
+- tasks:
+  # probe the source first
+  - register: probe
+    service: {source: "{{ source }}", name: ffprobe}
+    name: probe
+  - service: {name: shell}
+    when: probe.success
+    name: report
+  stage: analyze
+parameters:
+- name: source
+name: probe
+`, nil)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Print(string(formatted))
+	// Output:
+	// ---
+	// name: probe
+	// parameters:
+	//   - source
+	// stages:
+	//   - stage: analyze
+	//     tasks:
+	//       # probe the source first
+	//       - name: probe
+	//         service:
+	//           name: ffprobe
+	//           source: '{{ source }}'
+	//         register: probe
+	//       - name: report
+	//         service: shell
+	//         when: probe.success
+}
+
+// TestFormatTestPipelines - formatting the pipelines in test/ is idempotent and keeps their meaning
+func TestFormatTestPipelines(t *testing.T) {
+	files, err := filepath.Glob("../../test/*.pipe")
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no test pipelines found: %v", err)
+	}
+
+	checked := 0
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatalf("unable to read %s: %s", file, err)
+		}
+		parser := NewParser().Loader(FileLoader{})
+		original, err := parser.Parse(file, string(b))
+		if err != nil {
+			// only valid pipelines can be formatted
+			continue
+		}
+		checked++
+
+		formatted, err := Format(file, string(b), FileLoader{})
+		if err != nil {
+			t.Errorf("%s: unable to format: %s", file, err)
+			continue
+		}
+		again, err := Format(file, string(formatted), FileLoader{})
+		if err != nil || string(again) != string(formatted) {
+			t.Errorf("%s: formatting is not idempotent (%v):\n%s\n---\n%s", file, err, formatted, again)
+		}
+
+		parsed, err := parser.Parse(file, string(formatted))
+		if err != nil || !Equivalent(original, parsed) {
+			t.Errorf("%s: formatted pipeline is not equivalent (%v):\n%s", file, err, formatted)
+		}
+
+		// the marshaled pipeline has its references resolved, but has to mean the same
+		marshaled, err := Marshal(original)
+		if err != nil {
+			t.Errorf("%s: unable to marshal: %s", file, err)
+			continue
+		}
+		unmarshaled, err := parser.Parse("", string(marshaled))
+		if err != nil || !Equivalent(original, unmarshaled) {
+			t.Errorf("%s: marshaled pipeline is not equivalent (%v):\n%s", file, err, marshaled)
+		}
+	}
+	if checked == 0 {
+		t.Errorf("none of the test pipelines is valid")
+	}
+}
+
+func TestEquivalent(t *testing.T) {
+	parse := func(script string) *Pipeline {
+		p, err := CreateFromBytes("---\nstages:\n- stage: s\n  tasks:\n" + script)
+		if err != nil {
+			t.Fatalf("unable to parse %q: %s", script, err)
+		}
+		return p
+	}
+
+	short := parse("  - service: shell\n")
+	if !Equivalent(short, parse("  - service: {name: shell}\n")) {
+		t.Errorf("the short form of a service is not equivalent to its long form")
+	}
+	if Equivalent(short, parse("  - service: {name: shell, cmd: echo}\n")) {
+		t.Errorf("services with different inputs are equivalent")
+	}
+	if Equivalent(short, parse("  - service: shell\n    ignore_errors: true\n")) {
+		t.Errorf("tasks with different settings are equivalent")
+	}
+}
+
+// TestFormatTypedValues - quoted booleans and integers are written with the type they are parsed as
+func TestFormatTypedValues(t *testing.T) {
+	script := `---
+parameters:
+- name: overwrite
+  type: bool
+  required: "True"
+stages:
+- stage: s
+  parallel: "true"
+  max_parallel: "2"
+  until: "true"
+  max_iterations: 0x10
+  tasks:
+  - service: shell
+    ignore_errors: 'FALSE'
+    retries: "+3"
+  - set_fact: {quoted: "true", number: "1"}
+`
+	expects := `---
+parameters:
+  - name: overwrite
+    type: bool
+    required: true
+stages:
+  - stage: s
+    until: "true"
+    max_iterations: 16
+    parallel: true
+    max_parallel: 2
+    tasks:
+      - service: shell
+        ignore_errors: false
+        retries: 3
+      - set_fact:
+          quoted: "true"
+          number: "1"
+`
+
+	formatted, err := Format("typed.pipe", script, nil)
+	if err != nil {
+		t.Fatalf("unable to format: %s", err)
+	}
+	if string(formatted) != expects {
+		t.Errorf("formatted:\n%s\nexpected:\n%s", formatted, expects)
+	}
+
+	original, err := CreateFromBytes(script)
+	if err != nil {
+		t.Fatalf("unable to parse: %s", err)
+	}
+	for _, result := range [][]byte{formatted, mustMarshal(t, original)} {
+		parsed, err := CreateFromBytes(string(result))
+		if err != nil || !Equivalent(original, parsed) {
+			t.Errorf("pipeline is not equivalent after the round trip (%v):\n%s", err, result)
+		}
+	}
+}
+
+func mustMarshal(t *testing.T, p *Pipeline) []byte {
+	t.Helper()
+	b, err := Marshal(p)
+	if err != nil {
+		t.Fatalf("unable to marshal: %s", err)
+	}
+	return b
+}
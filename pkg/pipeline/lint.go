@@ -0,0 +1,292 @@
+package pipeline
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/d5/tengo/v2"
+)
+
+// inputFunctions - functions which are only provided while the inputs of a dispatched task are rendered
+var inputFunctions = []string{"secret"}
+
+// linter - walks a parsed pipeline and tracks the variables which are visible to each expression
+type linter struct {
+	catalog   *ServiceCatalog
+	file      string
+	diags     Diagnostics
+	registers []*Task         // tasks which register their result, in the order they have been declared
+	used      map[string]bool // all identifiers referenced by expressions
+}
+
+// Lint - checks the pipeline for problems the parser cannot detect on its own:
+// expressions which do not compile, references to unknown variables, unknown services and unused registers
+// services are not checked if catalog is nil, file is used for problems without a task
+func Lint(p *Pipeline, file string, catalog *ServiceCatalog) Diagnostics {
+	diags := lintPipeline(p, file, catalog)
+
+	// sub-pipelines are keyed by the file they have been loaded from
+	files := make([]string, 0, len(p.Pipelines))
+	for f := range p.Pipelines {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	for _, f := range files {
+		diags = append(diags, lintPipeline(p.Pipelines[f], f, catalog)...)
+	}
+
+	return diags
+}
+
+func lintPipeline(p *Pipeline, file string, catalog *ServiceCatalog) Diagnostics {
+	l := &linter{
+		catalog: catalog,
+		file:    file,
+		used:    make(map[string]bool),
+	}
+
+	scope := make(map[string]bool)
+	for _, param := range p.Parameters {
+		scope[param.Name] = true
+	}
+	scope = l.variables(p.Variables, scope)
+
+	for i := range p.Stages {
+		stage := &p.Stages[i]
+		stageScope := scope
+		if stage.Matrix != nil {
+			stageScope = with(scope, "matrix")
+		}
+		if stage.When.Script != "" {
+			l.expression(&stage.Source, "`when` of stage `"+stage.Name+"`", stage.When.Script, stageScope)
+		}
+		if stage.Until.Script != "" {
+			stageScope = with(stageScope, "iteration")
+		}
+		stageScope = l.variables(stage.Variables, stageScope)
+		for j := range stage.Tasks {
+			l.task(&stage.Tasks[j], stageScope)
+			l.register(&stage.Tasks[j], scope, stageScope)
+		}
+		if stage.Until.Script != "" {
+			l.expression(&stage.Source, "`until` of stage `"+stage.Name+"`", stage.Until.Script, stageScope)
+		}
+		l.block(stage.OnFailure, with(stageScope, "failed", "failure"))
+		l.block(stage.Always, with(stageScope, "failed", "failure"))
+	}
+
+	// handlers run after the stages which notified them
+	for i := range p.Handlers {
+		l.task(&p.Handlers[i], scope)
+		l.register(&p.Handlers[i], scope)
+	}
+	l.block(p.OnFailure, with(scope, "failed", "failure"))
+	l.block(p.Always, with(scope, "failed", "failure"))
+
+	for i := range p.Outputs {
+		output := &p.Outputs[i]
+		l.expression(&output.Source, "output `"+output.Name+"`", output.Value.Script, scope)
+	}
+
+	for _, task := range l.registers {
+		if !l.used[task.Register] {
+			l.warnf(&task.Source, "registered result `%s` is never used", task.Register)
+		}
+	}
+
+	return l.diags
+}
+
+// block - checks the tasks of an `on_failure` or `always` block
+func (l *linter) block(tasks []Task, scope map[string]bool) {
+	for i := range tasks {
+		l.task(&tasks[i], scope)
+		l.register(&tasks[i], scope)
+	}
+}
+
+// register - makes the result and the facts of the task visible to all following tasks
+func (l *linter) register(task *Task, scopes ...map[string]bool) {
+	if task.Local == SetFactTask {
+		for name := range task.Parameters {
+			for _, scope := range scopes {
+				scope[name] = true
+			}
+		}
+	}
+	if task.Register == "" {
+		return
+	}
+	l.registers = append(l.registers, task)
+	for _, scope := range scopes {
+		scope[task.Register] = true
+	}
+}
+
+// task - checks the service and all expressions of the task
+func (l *linter) task(task *Task, scope map[string]bool) {
+	if task.Service != "" && l.catalog != nil && l.catalog.Service(task.Service) == nil {
+		l.errorf(&task.Source, "unknown service `%s`", task.Service)
+	}
+
+	if task.Matrix != nil {
+		scope = with(scope, "matrix")
+	}
+	if task.Loop.Script != "" {
+		l.expression(&task.Source, "loop", task.Loop.Script, scope)
+	}
+
+	scope = l.variables(task.Variables, scope)
+	if task.Loop.Script != "" || task.Items != nil {
+		scope = with(scope, "item", "index")
+	}
+
+	if task.When.Script != "" {
+		l.expression(&task.Source, "when", task.When.Script, scope)
+	}
+
+	switch task.Local {
+	case AssertTask:
+		for _, condition := range task.Conditions() {
+			l.expression(&task.Source, "assert", condition, scope)
+		}
+		l.templates(&task.Source, "message", task.Message(), scope)
+
+	case FailTask:
+		l.templates(&task.Source, "message", task.Message(), scope)
+
+	default:
+		what := "input"
+		if task.Local == SetFactTask {
+			what = "fact"
+		} else {
+			scope = with(scope, inputFunctions...)
+		}
+		keys := make([]string, 0, len(task.Parameters))
+		for key := range task.Parameters {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			l.templates(&task.Source, what+" `"+key+"`", task.Parameters[key], scope)
+		}
+	}
+
+	for _, on := range task.Retry.On {
+		if !IsErrorClass(on) {
+			l.expression(&task.Source, "retry_on", on, with(scope, "message", "class", "attempt"))
+		}
+	}
+}
+
+// variables - checks the variables in the order they have been declared and returns the resulting scope
+func (l *linter) variables(variables []Variable, scope map[string]bool) map[string]bool {
+	if len(variables) == 0 {
+		return scope
+	}
+	result := with(scope)
+	for i := range variables {
+		v := &variables[i]
+		l.templates(&v.Source, "variable `"+v.Name+"`", v.Value, result)
+		result[v.Name] = true
+	}
+	return result
+}
+
+// templates - checks all `{{ }}` expressions in the strings of the value
+func (l *linter) templates(src *Source, what string, value interface{}, scope map[string]bool) {
+	switch v := value.(type) {
+	case string:
+		for _, m := range templatePattern.FindAllString(v, -1) {
+			l.expression(src, what, strings.TrimSpace(m[2:len(m)-2]), scope)
+		}
+
+	case []interface{}:
+		for _, entry := range v {
+			l.templates(src, what, entry, scope)
+		}
+
+	case map[string]interface{}:
+		for _, entry := range v {
+			l.templates(src, what, entry, scope)
+		}
+	}
+}
+
+// expression - compiles the expression against the variables in scope and records all referenced identifiers
+func (l *linter) expression(src *Source, what string, script string, scope map[string]bool) {
+	l.identifiers(script)
+
+	s := tengo.NewScript([]byte(`out := ` + script))
+	s.SetImports(modules())
+	for name := range globals() {
+		_ = s.Add(name, nil)
+	}
+	for name := range scope {
+		_ = s.Add(name, nil)
+	}
+
+	if _, err := s.Compile(); err != nil {
+		if m := unresolvedReference.FindStringSubmatch(err.Error()); m != nil {
+			if contains(inputFunctions, m[1]) {
+				l.errorf(src, "`%s` is only available in the inputs of tasks which are dispatched, not in %s `%s`", m[1], what, script)
+				return
+			}
+			l.errorf(src, "unknown variable `%s` in %s `%s`", m[1], what, script)
+			return
+		}
+		msg := strings.SplitN(err.Error(), "\n", 2)[0]
+		l.errorf(src, "invalid expression in %s `%s`: %s", what, script, msg)
+	}
+}
+
+// identifiers - marks all identifiers of the expression as used
+func (l *linter) identifiers(script string) {
+	for _, name := range identifiers(script) {
+		l.used[name] = true
+	}
+}
+
+func (l *linter) errorf(src *Source, format string, args ...interface{}) {
+	l.report(l.diagnostic(src, SeverityError, format, args...))
+}
+
+func (l *linter) warnf(src *Source, format string, args ...interface{}) {
+	l.report(l.diagnostic(src, SeverityWarning, format, args...))
+}
+
+// report - adds the diagnostic once, tasks expanded from a `matrix` are checked for every combination
+func (l *linter) report(diag Diagnostic) {
+	for _, d := range l.diags {
+		if d == diag {
+			return
+		}
+	}
+	l.diags = append(l.diags, diag)
+}
+
+// diagnostic - creates a diagnostic at the position of the element, problems of elements without a position are reported for the file
+func (l *linter) diagnostic(src *Source, severity Severity, format string, args ...interface{}) Diagnostic {
+	diag := newDiagnostic(severity, format, args...)
+	diag.File = l.file
+	if src != nil && src.Line > 0 {
+		if src.File != "" {
+			diag.File = src.File
+		}
+		diag.Line = src.Line
+		diag.Column = src.Column
+	}
+	return diag
+}
+
+// with - returns a copy of the scope which additionally contains the given names
+func with(scope map[string]bool, names ...string) map[string]bool {
+	result := make(map[string]bool, len(scope)+len(names))
+	for name := range scope {
+		result[name] = true
+	}
+	for _, name := range names {
+		result[name] = true
+	}
+	return result
+}
@@ -0,0 +1,78 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSecretsAreOnlyAllowedInTaskInputs(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		where  string // empty if the pipeline is valid
+	}{
+		{"service input", `
+stages:
+- stage: s
+  tasks:
+  - service: {name: shell, cmd: 'login {{ secret("db") }}'}
+`, ""},
+		{"variable", `
+vars:
+  password: '{{ secret("db") }}'
+stages:
+- stage: s
+  tasks:
+  - service: {name: shell, cmd: 'login {{ password }}'}
+`, "variable `password`"},
+		{"fact", `
+stages:
+- stage: s
+  tasks:
+  - set_fact: {password: '{{ secret("db") }}'}
+  - service: {name: shell, cmd: 'login {{ password }}'}
+`, "fact `password`"},
+		{"when", `
+stages:
+- stage: s
+  tasks:
+  - service: shell
+    when: secret("db") != ""
+`, "when"},
+		{"message", `
+stages:
+- stage: s
+  tasks:
+  - fail: 'login {{ secret("db") }}'
+`, "message"},
+		{"output", `
+stages:
+- stage: s
+  tasks:
+  - service: shell
+outputs:
+  password: secret("db")
+`, "output `password`"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, err := CreateFromBytes("---" + test.script)
+			if err != nil {
+				t.Fatalf("unable to parse pipeline: %s", err)
+			}
+
+			diags := Lint(p, "test.pipe", nil)
+			if test.where == "" {
+				if diags.HasErrors() {
+					t.Errorf("unexpected errors:\n%s", diags.Error())
+				}
+				return
+			}
+			msg := diags.Error()
+			if !diags.HasErrors() || !strings.Contains(msg, "`secret` is only available in the inputs of tasks") || !strings.Contains(msg, "in "+test.where) {
+				t.Errorf("expected `secret` to be rejected in %s, got:\n%s", test.where, msg)
+			}
+		})
+	}
+}
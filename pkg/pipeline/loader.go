@@ -0,0 +1,30 @@
+package pipeline
+
+import (
+	"io/ioutil"
+	"path/filepath"
+)
+
+// Loader - Resolves `include` and `import` references of a pipeline script
+type Loader interface {
+	// Load - returns the resolved file name and the contents of the reference `ref`
+	// which has been found in the file `from`
+	Load(from string, ref string) (string, string, error)
+}
+
+// FileLoader - Resolves references as paths relative to the file they are referenced from
+type FileLoader struct{}
+
+// Load - reads the referenced file from the local filesystem
+func (l FileLoader) Load(from string, ref string) (string, string, error) {
+	file := ref
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(filepath.Dir(from), ref)
+	}
+
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		return file, "", err
+	}
+	return file, string(contents), nil
+}
@@ -0,0 +1,92 @@
+package pipeline
+
+import (
+	"gopkg.in/yaml.v3"
+)
+
+// LocalTaskType - a task which is evaluated by the execution itself instead of being dispatched to a service
+type LocalTaskType string
+
+const (
+	// SetFactTask - evaluates its inputs and stores them as job variables
+	SetFactTask LocalTaskType = "set_fact"
+	// AssertTask - fails unless all conditions in `that` are true
+	AssertTask LocalTaskType = "assert"
+	// FailTask - fails with the given message
+	FailTask LocalTaskType = "fail"
+)
+
+// LocalTaskTypes - all task types which are evaluated locally
+var LocalTaskTypes = []LocalTaskType{SetFactTask, AssertTask, FailTask}
+
+// Conditions - returns the conditions of an `assert` task
+func (t *Task) Conditions() []string {
+	that, _ := t.Parameters["that"].([]interface{})
+	result := make([]string, 0, len(that))
+	for _, condition := range that {
+		if s, ok := condition.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// Message - returns the message of an `assert` or `fail` task
+func (t *Task) Message() string {
+	message, _ := t.Parameters["message"].(string)
+	return message
+}
+
+// parseSetFact - parses the variables of a `set_fact` task
+func (d *decoder) parseSetFact(task *Task, node *yaml.Node) {
+	task.Local = SetFactTask
+	task.Parameters = make(map[string]interface{})
+	d.mapping(node, "set_fact", func(key string, keyNode *yaml.Node, value *yaml.Node) {
+		if v, ok := d.value(value, "fact `"+key+"`"); ok {
+			d.templates(value, "fact `"+key+"`")
+			task.Parameters[key] = v
+		}
+	})
+}
+
+// parseAssert - parses either a list of conditions or a mapping with `that` and `message`
+func (d *decoder) parseAssert(task *Task, node *yaml.Node) {
+	task.Local = AssertTask
+	task.Parameters = make(map[string]interface{})
+
+	node = resolve(node)
+	that := node
+	if node.Kind == yaml.MappingNode {
+		that = resolve(findKey(node, "that"))
+		if message := findKey(node, "message"); message != nil {
+			task.Parameters["message"], _ = d.str(message, "message")
+			d.templates(message, "message")
+		}
+	}
+
+	conditions, _ := d.strList(that, "that")
+	list := make([]interface{}, len(conditions))
+	for i, condition := range conditions {
+		at := that
+		if that.Kind == yaml.SequenceNode {
+			at = that.Content[i]
+		}
+		list[i] = d.expression(at, "assert", unwrap(condition)).Script
+	}
+	task.Parameters["that"] = list
+}
+
+// parseFail - parses either the message or a mapping with `message`
+func (d *decoder) parseFail(task *Task, node *yaml.Node) {
+	task.Local = FailTask
+	message := resolve(node)
+	if message.Kind == yaml.MappingNode {
+		message = findKey(message, "message")
+	}
+	if s, ok := d.str(message, "message"); ok {
+		d.templates(message, "message")
+		task.Parameters = map[string]interface{}{
+			"message": s,
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package pipeline
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"gopkg.in/yaml.v3"
+)
+
+// maxMatrixCombinations - the amount of tasks or stages a single `matrix` can expand into
+const maxMatrixCombinations = 256
+
+// Matrix - a single combination of a `matrix`, it is available as `matrix` in expressions
+type Matrix map[string]interface{}
+
+// String - formats the combination as `key=value` pairs ordered by their key
+func (m Matrix) String() string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = fmt.Sprintf("%s=%v", key, m[key])
+	}
+	return strings.Join(pairs, ", ")
+}
+
+// UnmarshalBSONValue - converts the values of the combination into plain go maps and slices
+func (m *Matrix) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	if t == bsontype.Null {
+		*m = nil
+		return nil
+	}
+	var v map[string]interface{}
+	if err := (bson.RawValue{Type: t, Value: data}).Unmarshal(&v); err != nil {
+		return err
+	}
+	*m = FromBSON(v).(map[string]interface{})
+	return nil
+}
+
+// matches - checks if the combination contains all values of the entry
+func (m Matrix) matches(entry Matrix) bool {
+	for key, value := range entry {
+		if v, ok := m[key]; !ok || !reflect.DeepEqual(v, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// DisplayName - the name of the task followed by its matrix combination
+func (t *Task) DisplayName() string {
+	return matrixName(t.Name, t.Matrix)
+}
+
+// DisplayName - the name of the stage followed by its matrix combination
+func (s *Stage) DisplayName() string {
+	return matrixName(s.Name, s.Matrix)
+}
+
+func matrixName(name string, m Matrix) string {
+	if len(m) == 0 {
+		return name
+	}
+	return strings.TrimSpace(name + " (" + m.String() + ")")
+}
+
+// matrixRef - the combinations of a task which are expanded once the surrounding list is parsed
+type matrixRef struct {
+	node         *yaml.Node
+	combinations []Matrix
+}
+
+// parseMatrix - returns the cartesian product of all keys of the matrix
+// `exclude` entries remove all combinations containing their values,
+// `include` entries extend all combinations matching their values of the matrix keys or are added as a new combination
+func (d *decoder) parseMatrix(node *yaml.Node) ([]Matrix, bool) {
+	start := len(d.diags)
+	var keys []string
+	values := make(map[string][]interface{})
+	var include, exclude []Matrix
+	var excludeNodes []*yaml.Node
+	d.mapping(node, "matrix", func(key string, keyNode *yaml.Node, value *yaml.Node) {
+		switch key {
+		case "include", "exclude":
+			d.sequence(value, key, func(entry *yaml.Node) {
+				v, ok := d.value(entry, "matrix "+key)
+				if !ok {
+					return
+				}
+				if key == "include" {
+					include = append(include, v.(map[string]interface{}))
+				} else {
+					exclude = append(exclude, v.(map[string]interface{}))
+					excludeNodes = append(excludeNodes, entry)
+				}
+			})
+
+		default:
+			v, ok := d.value(value, "matrix `"+key+"`")
+			if !ok {
+				return
+			}
+			if list := v.([]interface{}); len(list) > 0 {
+				keys = append(keys, key)
+				values[key] = list
+			} else {
+				d.errorf(value, "matrix `%s` requires at least one value", key)
+			}
+		}
+	})
+	for i, entry := range exclude {
+		for key := range entry {
+			if _, ok := values[key]; !ok {
+				d.errorf(excludeNodes[i], "unknown matrix key `%s` in exclude", key)
+			}
+		}
+	}
+	if len(d.diags) > start {
+		return nil, false
+	}
+
+	var combinations []Matrix
+	if len(keys) > 0 {
+		combinations = []Matrix{{}}
+	}
+	for _, key := range keys {
+		if len(combinations)*len(values[key]) > maxMatrixCombinations {
+			d.errorf(node, "matrix expands into more than %d combinations", maxMatrixCombinations)
+			return nil, false
+		}
+		next := make([]Matrix, 0, len(combinations)*len(values[key]))
+		for _, c := range combinations {
+			for _, value := range values[key] {
+				next = append(next, c.with(Matrix{key: value}))
+			}
+		}
+		combinations = next
+	}
+
+	result := combinations[:0]
+	for _, c := range combinations {
+		excluded := false
+		for _, entry := range exclude {
+			excluded = excluded || c.matches(entry)
+		}
+		if !excluded {
+			result = append(result, c)
+		}
+	}
+
+	for _, entry := range include {
+		matrixValues, extra := Matrix{}, Matrix{}
+		for key, value := range entry {
+			if _, ok := values[key]; ok {
+				matrixValues[key] = value
+			} else {
+				extra[key] = value
+			}
+		}
+		extended := false
+		for i, c := range result {
+			if c.matches(matrixValues) {
+				result[i] = extra.with(c)
+				extended = true
+			}
+		}
+		if !extended {
+			result = append(result, entry)
+		}
+	}
+
+	switch {
+	case len(result) == 0:
+		d.errorf(node, "matrix has no combinations")
+		return nil, false
+	case len(result) > maxMatrixCombinations:
+		d.errorf(node, "matrix expands into more than %d combinations", maxMatrixCombinations)
+		return nil, false
+	}
+	return result, true
+}
+
+// with - returns a copy of the combination with the values of other, values of other take precedence
+func (m Matrix) with(other Matrix) Matrix {
+	result := make(Matrix, len(m)+len(other))
+	for key, value := range m {
+		result[key] = value
+	}
+	for key, value := range other {
+		result[key] = value
+	}
+	return result
+}
+
+// expand - returns a copy of the task for every combination of its `matrix`
+func (d *decoder) expand(task *Task) []Task {
+	ref, ok := d.matrices[task]
+	if !ok {
+		return []Task{*task}
+	}
+	delete(d.matrices, task)
+
+	result := make([]Task, len(ref.combinations))
+	for i, c := range ref.combinations {
+		result[i] = *task
+		result[i].Matrix = c
+	}
+	return result
+}
@@ -0,0 +1,133 @@
+package pipeline
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMatrixCombinations(t *testing.T) {
+	tests := []struct {
+		name    string
+		matrix  string
+		expects []Matrix
+	}{
+		{
+			name: "cartesian product in declaration order",
+			matrix: `
+      codec: [h264, hevc]
+      height: [720, 480]`,
+			expects: []Matrix{
+				{"codec": "h264", "height": 720},
+				{"codec": "h264", "height": 480},
+				{"codec": "hevc", "height": 720},
+				{"codec": "hevc", "height": 480},
+			},
+		},
+		{
+			name: "exclude removes matching combinations",
+			matrix: `
+      codec: [h264, hevc]
+      height: [720, 480]
+      exclude:
+      - codec: hevc
+        height: 480`,
+			expects: []Matrix{
+				{"codec": "h264", "height": 720},
+				{"codec": "h264", "height": 480},
+				{"codec": "hevc", "height": 720},
+			},
+		},
+		{
+			name: "include extends matching combinations or adds new ones",
+			matrix: `
+      codec: [h264, hevc]
+      include:
+      - codec: hevc
+        tag: hvc1
+      - codec: av1
+        experimental: true`,
+			expects: []Matrix{
+				{"codec": "h264"},
+				{"codec": "hevc", "tag": "hvc1"},
+				{"codec": "av1", "experimental": true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := CreateFromBytes(`---
+stages:
+- stage: transcode
+  tasks:
+  - name: encode
+    matrix:` + tt.matrix + `
+    service: shell
+`)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			var combinations []Matrix
+			for _, task := range p.Stages[0].Tasks {
+				if task.Name != "encode" {
+					t.Errorf("expanded task is called %q", task.Name)
+				}
+				combinations = append(combinations, task.Matrix)
+			}
+			if !reflect.DeepEqual(combinations, tt.expects) {
+				t.Errorf("combinations = %v\nexpected %v", combinations, tt.expects)
+			}
+		})
+	}
+}
+
+func TestMatrixErrors(t *testing.T) {
+	errors := map[string]string{
+		"a: [1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17]\n      b: [1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17]": "matrix expands into more than 256 combinations",
+		"codec: [h264]\n      exclude:\n      - codec: h264": "matrix has no combinations",
+		"codec: [h264]\n      exclude:\n      - height: 720": "unknown matrix key `height` in exclude",
+		"codec: []": "matrix `codec` requires at least one value",
+	}
+	for matrix, expected := range errors {
+		_, err := CreateFromBytes("---\nstages:\n- stage: transcode\n  tasks:\n  - name: encode\n    matrix:\n      " + matrix + "\n    service: shell\n")
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("matrix:\n%s\nerror = %v, expected %q", matrix, err, expected)
+		}
+	}
+}
+
+func TestStageMatrixDependencies(t *testing.T) {
+	p, err := CreateFromBytes(`---
+stages:
+- stage: transcode
+  matrix:
+    codec: [h264, hevc]
+  tasks:
+  - name: encode
+    matrix:
+      height: [720, 480]
+    service: shell
+  - name: report
+    depends_on: encode
+    service: shell
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	var stages []string
+	for _, stage := range p.Stages {
+		stages = append(stages, stage.DisplayName())
+		if len(stage.Tasks) != 3 {
+			t.Errorf("stage %s has %d tasks, expected 3", stage.DisplayName(), len(stage.Tasks))
+		}
+		if indices := stage.TaskIndices("encode"); !reflect.DeepEqual(indices, []int{0, 1}) {
+			t.Errorf("encode resolves to %v, expected both combinations", indices)
+		}
+	}
+	expects := []string{"transcode (codec=h264)", "transcode (codec=hevc)"}
+	if !reflect.DeepEqual(stages, expects) {
+		t.Errorf("stages = %v, expected %v", stages, expects)
+	}
+}
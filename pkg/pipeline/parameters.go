@@ -0,0 +1,272 @@
+package pipeline
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ko1N/dips/pkg/taskstorage"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ParameterType - The type of a pipeline parameter
+type ParameterType string
+
+const (
+	StringParameter  ParameterType = "string"
+	IntParameter     ParameterType = "int"
+	BoolParameter    ParameterType = "bool"
+	ListParameter    ParameterType = "list"
+	MapParameter     ParameterType = "map"
+	FileURLParameter ParameterType = "file-url"
+)
+
+// ParameterTypes - all supported parameter types
+var ParameterTypes = []ParameterType{
+	StringParameter,
+	IntParameter,
+	BoolParameter,
+	ListParameter,
+	MapParameter,
+	FileURLParameter,
+}
+
+// Parameter - Describes an input parameter of a pipeline
+type Parameter struct {
+	Name        string        `json:"name" bson:"name"`
+	Type        ParameterType `json:"type" bson:"type"`
+	Description string        `json:"description,omitempty" bson:"description,omitempty"`
+	Default     interface{}   `json:"default,omitempty" bson:"default,omitempty"`
+	Required    bool          `json:"required" bson:"required"`
+	Enum        []interface{} `json:"enum,omitempty" bson:"enum,omitempty"`
+	Pattern     string        `json:"pattern,omitempty" bson:"pattern,omitempty"`
+}
+
+// ParameterError - Describes why the value of a single parameter was rejected
+type ParameterError struct {
+	Name    string `json:"name"`
+	Message string `json:"message"`
+}
+
+// ParameterErrors - List of all rejected parameters
+type ParameterErrors []ParameterError
+
+// Error - joins all parameter errors into a single error message
+func (e ParameterErrors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = "parameter `" + err.Name + "`: " + err.Message
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ParameterNames - returns the names of all declared parameters
+func (p *Pipeline) ParameterNames() []string {
+	names := make([]string, len(p.Parameters))
+	for i, param := range p.Parameters {
+		names[i] = param.Name
+	}
+	return names
+}
+
+// ValidateParameters - checks the values against the declared parameters
+// the returned map contains the coerced values and all defaults
+func (p *Pipeline) ValidateParameters(values map[string]interface{}) (map[string]interface{}, error) {
+	var errs ParameterErrors
+	result := make(map[string]interface{})
+
+	declared := make(map[string]bool)
+	for _, param := range p.Parameters {
+		declared[param.Name] = true
+
+		value, ok := values[param.Name]
+		if !ok || value == nil {
+			if param.Default != nil {
+				result[param.Name] = param.Default
+			} else if param.Required {
+				errs = append(errs, ParameterError{param.Name, "parameter is required"})
+			}
+			continue
+		}
+
+		v, err := param.Validate(value)
+		if err != nil {
+			errs = append(errs, ParameterError{param.Name, err.Error()})
+			continue
+		}
+		result[param.Name] = v
+	}
+
+	// report unknown parameters in a stable order
+	var unknown []string
+	for name := range values {
+		if !declared[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		errs = append(errs, ParameterError{name, "unknown parameter"})
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return result, nil
+}
+
+// Validate - coerces the value into the type of the parameter and checks all constraints
+func (p *Parameter) Validate(value interface{}) (interface{}, error) {
+	v, err := p.Type.Coerce(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(p.Enum) > 0 {
+		found := false
+		for _, e := range p.Enum {
+			if reflect.DeepEqual(e, v) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("must be one of %v", p.Enum)
+		}
+	}
+
+	if p.Pattern != "" {
+		re, err := regexp.Compile(p.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern `%s`: %s", p.Pattern, err)
+		}
+		if !re.MatchString(fmt.Sprint(v)) {
+			return nil, fmt.Errorf("must match pattern `%s`", p.Pattern)
+		}
+	}
+
+	return v, nil
+}
+
+// Coerce - converts the value into the go type used for this parameter type
+// strings are `string`, ints are `int64`, lists are `[]interface{}` and maps are `map[string]interface{}`
+func (t ParameterType) Coerce(value interface{}) (interface{}, error) {
+	value = FromBSON(value)
+	switch t {
+	case StringParameter:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+		return nil, fmt.Errorf("must be a string")
+
+	case IntParameter:
+		switch v := value.(type) {
+		case int:
+			return int64(v), nil
+		case int32:
+			return int64(v), nil
+		case int64:
+			return v, nil
+		case float64:
+			if v == math.Trunc(v) {
+				return int64(v), nil
+			}
+		case string:
+			if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return i, nil
+			}
+		}
+		return nil, fmt.Errorf("must be an int")
+
+	case BoolParameter:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			if b, err := strconv.ParseBool(v); err == nil {
+				return b, nil
+			}
+		}
+		return nil, fmt.Errorf("must be a bool")
+
+	case ListParameter:
+		if l, ok := value.([]interface{}); ok {
+			return l, nil
+		}
+		return nil, fmt.Errorf("must be a list")
+
+	case MapParameter:
+		if m, ok := value.(map[string]interface{}); ok {
+			return m, nil
+		}
+		return nil, fmt.Errorf("must be a map")
+
+	case FileURLParameter:
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("must be a file url")
+		}
+		url, err := taskstorage.ParseFileUrl(s)
+		if err != nil || url.URL.Scheme == "" || url.URL.Host == "" {
+			return nil, fmt.Errorf("must be a file url of the form `scheme://host/storage/path`")
+		}
+		return s, nil
+	}
+
+	return nil, fmt.Errorf("unknown parameter type `%s`", t)
+}
+
+// UnmarshalBSONValue - also accepts parameters which have been stored as plain names
+func (p *Parameter) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	raw := bson.RawValue{Type: t, Value: data}
+	if name, ok := raw.StringValueOK(); ok {
+		*p = Parameter{
+			Name: name,
+			Type: StringParameter,
+		}
+		return nil
+	}
+
+	type parameter Parameter
+	var v parameter
+	if err := raw.Unmarshal(&v); err != nil {
+		return err
+	}
+	*p = Parameter(v)
+	p.Default = FromBSON(p.Default)
+	for i := range p.Enum {
+		p.Enum[i] = FromBSON(p.Enum[i])
+	}
+	return nil
+}
+
+// FromBSON - converts the generic bson containers into plain go maps and slices
+func FromBSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case primitive.A:
+		return FromBSON([]interface{}(v))
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, e := range v {
+			result[i] = FromBSON(e)
+		}
+		return result
+	case primitive.D:
+		return FromBSON(v.Map())
+	case primitive.M:
+		return FromBSON(map[string]interface{}(v))
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			result[k] = FromBSON(e)
+		}
+		return result
+	}
+	return value
+}
@@ -0,0 +1,163 @@
+package pipeline
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseParameters(t *testing.T) {
+	p, err := CreateFromBytes(`---
+parameters:
+- source
+- name: height
+  type: int
+  default: "720"
+  required: false
+- name: codec
+  enum: [h264, hevc]
+  description: video codec
+stages: []
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	expects := []Parameter{
+		{Name: "source", Type: StringParameter},
+		{Name: "height", Type: IntParameter, Default: int64(720)},
+		{Name: "codec", Type: StringParameter, Description: "video codec", Enum: []interface{}{"h264", "hevc"}},
+	}
+	if !reflect.DeepEqual(p.Parameters, expects) {
+		t.Errorf("parameters = %+v\nexpected %+v", p.Parameters, expects)
+	}
+}
+
+func TestParseInvalidParameters(t *testing.T) {
+	// each declaration is reported at the offending node
+	invalid := map[string]string{
+		"- name: height\n  type: int\n  default: abc\n": "5:12: default must be an int",
+		"- name: ratio\n  type: float\n":                "4:9: type must be one of [string int bool list map file-url]",
+		"- type: int\n":                                 "3:3: parameter is missing `name`",
+		"- name: codec\n  enum: [h264, 5]\n":            "4:16: enum value must be a string",
+		"- name: codec\n  pattern: '['\n":               "4:12: invalid pattern",
+		"- name: codec\n  values: [h264]\n":             "4:3: unknown key `values` in parameter",
+	}
+	for declaration, expects := range invalid {
+		_, err := CreateFromBytes("---\nparameters:\n" + declaration + "stages: []\n")
+		if err == nil || !strings.Contains(err.Error(), expects) {
+			t.Errorf("parameters:\n%s\nerror = %v, expected %q", declaration, err, expects)
+		}
+	}
+}
+
+func TestValidateParameters(t *testing.T) {
+	p := &Pipeline{
+		Parameters: []Parameter{
+			{Name: "source", Type: FileURLParameter, Required: true},
+			{Name: "height", Type: IntParameter, Default: int64(720)},
+			{Name: "codec", Type: StringParameter, Enum: []interface{}{"h264", "hevc"}},
+			{Name: "preset", Type: StringParameter, Pattern: "^[a-z]+$"},
+			{Name: "dry", Type: BoolParameter},
+			{Name: "sizes", Type: ListParameter},
+			{Name: "tags", Type: MapParameter},
+		},
+	}
+	source := "minio://localhost:9000/input/video.mp4"
+
+	tests := []struct {
+		name    string
+		values  map[string]interface{}
+		expects map[string]interface{}
+		errors  ParameterErrors
+	}{
+		{
+			name:    "defaults",
+			values:  map[string]interface{}{"source": source},
+			expects: map[string]interface{}{"source": source, "height": int64(720)},
+		},
+		{
+			name: "coerced values",
+			values: map[string]interface{}{
+				"source": source,
+				"height": "480",
+				"dry":    "true",
+				"sizes":  []interface{}{1, 2},
+				"tags":   map[string]interface{}{"a": "b"},
+			},
+			expects: map[string]interface{}{
+				"source": source,
+				"height": int64(480),
+				"dry":    true,
+				"sizes":  []interface{}{1, 2},
+				"tags":   map[string]interface{}{"a": "b"},
+			},
+		},
+		{
+			name:    "float without fraction",
+			values:  map[string]interface{}{"source": source, "height": float64(1080)},
+			expects: map[string]interface{}{"source": source, "height": int64(1080)},
+		},
+		{
+			name:    "enum and pattern",
+			values:  map[string]interface{}{"source": source, "codec": "hevc", "preset": "fast"},
+			expects: map[string]interface{}{"source": source, "height": int64(720), "codec": "hevc", "preset": "fast"},
+		},
+		{
+			name:   "missing required parameter",
+			values: map[string]interface{}{},
+			errors: ParameterErrors{{"source", "parameter is required"}},
+		},
+		{
+			name:   "invalid file url",
+			values: map[string]interface{}{"source": "video.mp4"},
+			errors: ParameterErrors{{"source", "must be a file url of the form `scheme://host/storage/path`"}},
+		},
+		{
+			name:   "wrong types",
+			values: map[string]interface{}{"source": source, "height": 1.5, "dry": "maybe", "sizes": "1,2", "tags": []interface{}{}},
+			errors: ParameterErrors{
+				{"height", "must be an int"},
+				{"dry", "must be a bool"},
+				{"sizes", "must be a list"},
+				{"tags", "must be a map"},
+			},
+		},
+		{
+			name:   "enum and pattern mismatch",
+			values: map[string]interface{}{"source": source, "codec": "vp9", "preset": "Fast"},
+			errors: ParameterErrors{
+				{"codec", "must be one of [h264 hevc]"},
+				{"preset", "must match pattern `^[a-z]+$`"},
+			},
+		},
+		{
+			name:   "unknown parameters",
+			values: map[string]interface{}{"source": source, "z": 1, "a": 2},
+			errors: ParameterErrors{{"a", "unknown parameter"}, {"z", "unknown parameter"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := p.ValidateParameters(tt.values)
+			if tt.errors != nil {
+				var errs ParameterErrors
+				if !errors.As(err, &errs) {
+					t.Fatalf("expected parameter errors, got %v", err)
+				}
+				if !reflect.DeepEqual(errs, tt.errors) {
+					t.Errorf("errors = %v, expected %v", errs, tt.errors)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(result, tt.expects) {
+				t.Errorf("result = %v, expected %v", result, tt.expects)
+			}
+		})
+	}
+}
@@ -1,193 +1,1248 @@
 package pipeline
 
 import (
-	"errors"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
-	"gopkg.in/yaml.v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"gopkg.in/yaml.v3"
 )
 
 // Variable -
 type Variable struct {
-	Name  string `json:"name" bson:"name"`
-	Value string `json:"value" bson:"value"`
+	Name      string    `json:"name" bson:"name"`
+	Value     string    `json:"value" bson:"value"`
+	Source    Source    `json:"source" bson:"source"`
+	Templates Templates `json:"-" bson:"-"` // compiled templates of the value, set once the pipeline is compiled
+}
+
+// Output - Describes a named result of the pipeline which is evaluated when the job finished
+type Output struct {
+	Name   string     `json:"name" bson:"name"`
+	Value  Expression `json:"value" bson:"value"`
+	Source Source     `json:"source" bson:"source"`
+}
+
+// Source - Describes where an element of a pipeline has been declared
+type Source struct {
+	File   string `json:"file" bson:"file"`
+	Line   int    `json:"line" bson:"line"`
+	Column int    `json:"column" bson:"column"`
+}
+
+// String - formats the source as `file:line`
+func (s Source) String() string {
+	return s.File + ":" + strconv.Itoa(s.Line)
 }
 
 // Task -
 type Task struct {
 	Name         string                 `json:"name" bson:"name"`
 	Service      string                 `json:"service" bson:"service"`
+	Pipeline     string                 `json:"pipeline,omitempty" bson:"pipeline,omitempty"` // key of the sub-pipeline in the pipelines of the root pipeline
+	Local        LocalTaskType          `json:"local,omitempty" bson:"local,omitempty"`       // type of a task which is evaluated by the execution itself
 	Parameters   map[string]interface{} `json:"input" bson:"input"`
 	IgnoreErrors bool                   `json:"ignore_errors" bson:"ignore_errors"`
 	Register     string                 `json:"register" bson:"register"`
-	Notify       []string               `json:"notify" bson:"notify"` // NotifyRef
+	Notify       []string               `json:"notify" bson:"notify"` // names of handlers
 	When         Expression             `json:"when" bson:"when"`
+	Loop         Expression             `json:"loop" bson:"loop"`                         // evaluates to an array or a map
+	Items        []interface{}          `json:"items,omitempty" bson:"items,omitempty"`   // literal loop items
+	DependsOn    []string               `json:"depends_on" bson:"depends_on"`             // names of tasks in the same stage
+	Matrix       Matrix                 `json:"matrix,omitempty" bson:"matrix,omitempty"` // combination of the `matrix` the task has been expanded from
+	Retry        RetryPolicy            `json:"retry" bson:"retry"`
+	Timeout      Duration               `json:"timeout" bson:"timeout" swaggertype:"string"` // timeout of a single attempt, 0 uses the default of the runner
+	Variables    []Variable             `json:"variables" bson:"variables"`
+	Source       Source                 `json:"source" bson:"source"`
+	Templates    Templates              `json:"-" bson:"-"` // compiled templates, conditions and `retry_on` filters, set once the pipeline is compiled
+}
+
+// UnmarshalBSON - converts the typed input and loop items into plain go maps and slices
+func (t *Task) UnmarshalBSON(data []byte) error {
+	type task Task
+	var v task
+	if err := bson.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	*t = Task(v)
+	for key, value := range t.Parameters {
+		t.Parameters[key] = FromBSON(value)
+	}
+	for i := range t.Items {
+		t.Items[i] = FromBSON(t.Items[i])
+	}
+	return nil
+}
+
+// FailurePolicy - Describes what happens to the remaining tasks of a stage once a task failed
+type FailurePolicy string
+
+const (
+	// FailureCancel - no further tasks are dispatched and in-flight tasks are cancelled
+	FailureCancel FailurePolicy = "cancel"
+	// FailureDrain - all tasks which do not depend on the failed task are still executed
+	FailureDrain FailurePolicy = "drain"
+)
+
+// FailurePolicies - all supported failure policies
+var FailurePolicies = []FailurePolicy{
+	FailureCancel,
+	FailureDrain,
 }
 
 // Stage -
 type Stage struct {
-	Name  string `json:"name" bson:"name"`
-	Tasks []Task `json:"tasks" bson:"tasks"`
-	//Variables   []Variable `json:"variables" bson:"variables"`
+	Name          string        `json:"name" bson:"name"`
+	Source        Source        `json:"source" bson:"source"`
+	Matrix        Matrix        `json:"matrix,omitempty" bson:"matrix,omitempty"` // combination of the `matrix` the stage has been expanded from
+	Tasks         []Task        `json:"tasks" bson:"tasks"`
+	Variables     []Variable    `json:"variables" bson:"variables"`
+	When          Expression    `json:"when" bson:"when"`                        // the stage is skipped unless the expression is true
+	Until         Expression    `json:"until" bson:"until"`                      // the stage is repeated until the expression is true
+	MaxIterations int           `json:"max_iterations" bson:"max_iterations"`    // 0 uses the default of the executor
+	Delay         Duration      `json:"delay" bson:"delay" swaggertype:"string"` // delay between two iterations of the stage
+	FlushHandlers bool          `json:"flush_handlers" bson:"flush_handlers"`    // run notified handlers at the end of this stage
+	Parallel      bool          `json:"parallel" bson:"parallel"`
+	MaxParallel   int           `json:"max_parallel" bson:"max_parallel"` // 0 uses the default of the executor
+	FailurePolicy FailurePolicy `json:"failure_policy" bson:"failure_policy"`
+	OnFailure     []Task        `json:"on_failure,omitempty" bson:"on_failure,omitempty"` // run when a task of the stage failed
+	Always        []Task        `json:"always,omitempty" bson:"always,omitempty"`         // run after the stage whether it failed or not
 }
 
 // Pipeline -
 type Pipeline struct {
-	Name       string   `json:"name" bson:"name"`
-	Parameters []string `json:"parameters" bson:"parameters"`
-	Stages     []Stage  `json:"stages" bson:"stages"`
+	Name       string      `json:"name" bson:"name"`
+	Parameters []Parameter `json:"parameters" bson:"parameters"`
+	Variables  []Variable  `json:"variables" bson:"variables"`
+	Stages     []Stage     `json:"stages" bson:"stages"`
+	Handlers   []Task      `json:"handlers" bson:"handlers"`
+	Outputs    []Output    `json:"outputs" bson:"outputs"`
+	Timeout    Duration    `json:"timeout" bson:"timeout" swaggertype:"string"`      // deadline of the whole job, 0 means no deadline
+	OnFailure  []Task      `json:"on_failure,omitempty" bson:"on_failure,omitempty"` // run when the job failed
+	Always     []Task      `json:"always,omitempty" bson:"always,omitempty"`         // run after the job whether it failed or not
+
+	// all pipelines referenced by `pipeline:` tasks, only set on the root pipeline
+	Pipelines map[string]*Pipeline `json:"pipelines,omitempty" bson:"pipelines,omitempty"`
+}
+
+// Parser - Parses pipeline scripts and resolves all `include` and `import` references
+type Parser struct {
+	loader   Loader
+	catalog  *ServiceCatalog
+	includes string // reason why `include` references are not resolved, empty if they are
+}
+
+// parseState - state shared by the decoders of all files of a single pipeline
+type parseState struct {
+	programs  programs // programs of all expressions which have been compiled while parsing
+	loader    Loader
+	includes  string          // reason why `include` references are not resolved, empty if they are
+	catalog   *ServiceCatalog // services which can be used as keys of a task
+	schema    *Schema         // schema of the catalog, all files are validated against it
+	diags     Diagnostics
+	notifies  []nodeRef
+	dependsOn map[*Task]nodeRef
+	matrices  map[*Task]matrixRef
+	pipelines map[string]*Pipeline // sub-pipelines by the file they have been loaded from
+}
+
+// nodeRef - a node which is checked after the surrounding elements have been parsed
+type nodeRef struct {
+	decoder *decoder
+	node    *yaml.Node
+}
+
+// decoder - walks the yaml nodes of a single file and collects all diagnostics
+type decoder struct {
+	*parseState
+	file  string
+	stack []string // files which are currently being loaded, used to detect cycles
+}
+
+// NewParser - creates a new parser without a loader which uses the default service catalog
+func NewParser() *Parser {
+	return &Parser{
+		catalog: &DefaultServiceCatalog,
+	}
+}
+
+// Loader - Sets the loader used to resolve `include` and `import` references
+func (p *Parser) Loader(loader Loader) *Parser {
+	p.loader = loader
+	return p
+}
+
+// DisableIncludes - Reports every `include` reference with the reason instead of resolving it
+// `import` references are still resolved by the loader
+func (p *Parser) DisableIncludes(reason string) *Parser {
+	p.includes = reason
+	return p
+}
+
+// Catalog - Sets the services which can be used as keys of a task and their default inputs
+func (p *Parser) Catalog(catalog *ServiceCatalog) *Parser {
+	p.catalog = catalog
+	return p
+}
+
+// Parse - parses the pipeline script `data` which has been loaded from `file`
+// All problems are returned together as Diagnostics
+func (p *Parser) Parse(file string, data string) (*Pipeline, error) {
+	d := &decoder{
+		parseState: &parseState{
+			programs:  make(programs),
+			loader:    p.loader,
+			includes:  p.includes,
+			catalog:   p.catalog,
+			schema:    newSchema(nil, p.catalog),
+			dependsOn: make(map[*Task]nodeRef),
+			matrices:  make(map[*Task]matrixRef),
+			pipelines: make(map[string]*Pipeline),
+		},
+		file:  file,
+		stack: []string{file},
+	}
+
+	if !strings.HasPrefix(data, "---\n") {
+		d.errorf(&yaml.Node{Line: 1, Column: 1}, "not a valid pipeline script, should start with `---`")
+		return nil, d.diags
+	}
+
+	root := d.document(data)
+	if root == nil || !d.validate(root, definition("pipeline"), "pipeline") {
+		return nil, d.diags
+	}
+
+	result := d.parsePipeline(root)
+	d.checkNotifies(result)
+	if len(d.diags) > 0 {
+		return nil, d.diags
+	}
+	if len(d.pipelines) > 0 {
+		result.Pipelines = d.pipelines
+	}
+	if err := result.compile(d.programs); err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
 // CreateFromBytes - loads a new pipeline instance from a byte array
 func CreateFromBytes(data string) (*Pipeline, error) {
-	// TODO: multifile pipelines
-	if !strings.HasPrefix(string(data), "---\n") {
-		return nil, errors.New("Not a valid pipeline script. should start with `---`")
+	return NewParser().Parse("", data)
+}
+
+// document - unmarshals the yaml document and returns its root node
+func (d *decoder) document(data string) *yaml.Node {
+	var root yaml.Node
+	if err := yaml.Unmarshal([]byte(data), &root); err != nil {
+		d.yamlError(err)
+		return nil
+	}
+
+	if len(root.Content) == 0 {
+		d.errorf(&yaml.Node{Line: 1, Column: 1}, "pipeline script is empty")
+		return nil
 	}
 
-	var script interface{}
-	err := yaml.Unmarshal([]byte(data), &script)
+	return root.Content[0]
+}
+
+// load - resolves the reference in `node` and returns a decoder for the referenced file
+// the contents of the file are validated against the schema
+func (d *decoder) load(node *yaml.Node, what string, schema *Schema) (*decoder, *yaml.Node) {
+	ref, ok := d.str(node, what)
+	if !ok {
+		return nil, nil
+	}
+
+	if d.loader == nil {
+		d.errorf(node, "unable to resolve %s `%s`, no loader configured", what, ref)
+		return nil, nil
+	}
+	if what == "include" && d.includes != "" {
+		d.errorf(node, "unable to resolve include `%s`, %s", ref, d.includes)
+		return nil, nil
+	}
+
+	file, data, err := d.loader.Load(d.file, ref)
 	if err != nil {
-		return nil, err
+		d.errorf(node, "unable to load %s `%s`: %s", what, ref, err)
+		return nil, nil
 	}
 
-	if s, ok := script.(map[interface{}]interface{}); ok {
-		return parsePipeline(s)
+	for _, f := range d.stack {
+		if f == file {
+			d.errorf(node, "%s cycle detected: %s -> %s", what, strings.Join(d.stack, " -> "), file)
+			return nil, nil
+		}
 	}
 
-	return nil, errors.New("Not a valid pipeline script. Script should start with `name:` or `stages:`")
+	child := &decoder{
+		parseState: d.parseState,
+		file:       file,
+		stack:      append(append([]string{}, d.stack...), file),
+	}
+	root := child.document(data)
+	if root == nil || !child.validate(root, schema, what) {
+		return nil, nil
+	}
+	return child, root
 }
 
-func parsePipeline(script map[interface{}]interface{}) (*Pipeline, error) {
-	result := Pipeline{}
+// reference - returns the value of `key` if node is a mapping that only consists of the given key
+func reference(node *yaml.Node, key string) *yaml.Node {
+	node = resolve(node)
+	if node.Kind != yaml.MappingNode || len(node.Content) != 2 || node.Content[0].Value != key {
+		return nil
+	}
+	return node.Content[1]
+}
+
+// fragment - invokes fn for each entry in an included fragment which is either a single mapping or a list
+func (d *decoder) fragment(node *yaml.Node, fn func(*yaml.Node)) {
+	node = resolve(node)
+	if node.Kind == yaml.SequenceNode {
+		for _, entry := range node.Content {
+			fn(entry)
+		}
+	} else {
+		fn(node)
+	}
+}
 
-	if name, ok := script["name"]; ok {
-		result.Name = name.(string)
+func (d *decoder) parsePipeline(node *yaml.Node) *Pipeline {
+	result := &Pipeline{}
+
+	// the structure of the node has been validated against the schema already
+	node = resolve(node)
+	if node.Kind != yaml.MappingNode {
+		return result
 	}
 
-	if parameters, ok := script["parameters"]; ok {
-		for _, p := range parameters.([]interface{}) {
-			result.Parameters = append(result.Parameters, p.(string))
+	d.mapping(node, "pipeline", func(key string, keyNode *yaml.Node, value *yaml.Node) {
+		switch key {
+		case "name":
+			result.Name, _ = d.str(value, key)
+
+		case "parameters":
+			d.sequence(value, key, func(p *yaml.Node) {
+				if param, ok := d.parseParameter(p); ok {
+					result.Parameters = append(result.Parameters, param)
+				}
+			})
+
+		case "vars":
+			result.Variables = d.parseVariables(value)
+
+		case "stages":
+			d.sequence(value, key, func(s *yaml.Node) {
+				d.parseStages(result, s)
+			})
+
+		case "handlers":
+			d.sequence(value, key, func(h *yaml.Node) {
+				d.parseHandlers(result, h)
+			})
+
+		case "outputs":
+			result.Outputs = d.parseOutputs(value)
+
+		case "timeout":
+			result.Timeout, _ = d.duration(value, key)
+
+		case "on_failure":
+			result.OnFailure = d.parseBlock(value, key)
+
+		case "always":
+			result.Always = d.parseBlock(value, key)
+		}
+	})
+
+	return result
+}
+
+// parseStages - parses a single stage or resolves an `include` / `import` entry in the stages list
+func (d *decoder) parseStages(pipeline *Pipeline, node *yaml.Node) {
+	if ref := reference(node, "include"); ref != nil {
+		child, root := d.load(ref, "include", fragment(entries("pipeline", "stages")))
+		if child != nil {
+			child.fragment(root, func(s *yaml.Node) {
+				child.parseStages(pipeline, s)
+			})
 		}
+		return
 	}
 
-	if stages, ok := script["stages"]; ok {
-		for _, s := range stages.([]interface{}) {
-			stage, err := parseStage(s.(map[interface{}]interface{}))
-			if err != nil {
-				return nil, err
+	if ref := reference(node, "import"); ref != nil {
+		child, root := d.load(ref, "import", definition("pipeline"))
+		if child != nil {
+			imported := child.parsePipeline(root)
+			for _, p := range imported.Parameters {
+				if !contains(pipeline.ParameterNames(), p.Name) {
+					pipeline.Parameters = append(pipeline.Parameters, p)
+				}
+			}
+			pipeline.Stages = append(pipeline.Stages, imported.Stages...)
+			for _, h := range imported.Handlers {
+				if pipeline.Handler(h.Name) == nil {
+					pipeline.Handlers = append(pipeline.Handlers, h)
+				}
 			}
-			result.Stages = append(result.Stages, stage)
 		}
+		return
 	}
 
-	return &result, nil
+	pipeline.Stages = append(pipeline.Stages, d.parseStage(node)...)
 }
 
-func parseStage(script map[interface{}]interface{}) (Stage, error) {
-	if stage, ok := script["stage"]; ok {
-		//fmt.Println("Parsing stage" + stage.(string))
-		result := Stage{
-			Name: stage.(string),
+// parseStage - parses the stage, a stage with a `matrix` is expanded into a stage for every combination
+func (d *decoder) parseStage(node *yaml.Node) []Stage {
+	result := Stage{
+		Source:        d.source(node),
+		FailurePolicy: FailureCancel,
+	}
+	var dependsOn []nodeRef
+	var combinations []Matrix
+	var loopKeys []*yaml.Node // `max_iterations` and `delay` only apply to stages with `until`
+
+	node = resolve(node)
+	if node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	d.mapping(node, "stage", func(key string, keyNode *yaml.Node, value *yaml.Node) {
+		switch key {
+		case "stage":
+			result.Name, _ = d.str(value, key)
+
+		case "matrix":
+			combinations, _ = d.parseMatrix(value)
+
+		case "vars":
+			result.Variables = d.parseVariables(value)
+
+		case "when":
+			if script, ok := d.str(value, key); ok {
+				result.When = d.expression(value, key, script)
+			}
+
+		case "until":
+			if script, ok := d.str(value, key); ok {
+				result.Until = d.expression(value, key, unwrap(script))
+			}
+
+		case "max_iterations":
+			result.MaxIterations, _ = d.int(value, key)
+			loopKeys = append(loopKeys, keyNode)
+
+		case "delay":
+			result.Delay, _ = d.duration(value, key)
+			loopKeys = append(loopKeys, keyNode)
+
+		case "flush_handlers":
+			result.FlushHandlers, _ = d.bool(value, key)
+
+		case "parallel":
+			result.Parallel, _ = d.bool(value, key)
+
+		case "max_parallel":
+			result.MaxParallel, _ = d.int(value, key)
+
+		case "failure_policy":
+			if policy, ok := d.str(value, key); ok {
+				result.FailurePolicy = FailurePolicy(policy)
+			}
+
+		case "tasks":
+			d.sequence(value, key, func(t *yaml.Node) {
+				d.parseTasks(&result, &dependsOn, t)
+			})
+
+		case "on_failure":
+			result.OnFailure = d.parseBlock(value, key)
+
+		case "always":
+			result.Always = d.parseBlock(value, key)
 		}
+	})
 
-		var err error
-		result.Tasks, err = parseTasks(script)
-		if err != nil {
-			return result, err
+	if result.Until.Script == "" {
+		for _, key := range loopKeys {
+			d.errorf(key, "`%s` requires `until`", key.Value)
 		}
+	}
 
-		return result, nil
+	d.checkDependencies(&result, dependsOn)
+	if combinations == nil {
+		return []Stage{result}
 	}
 
-	return Stage{}, errors.New("Malformed stage. Should start with \"- stage: [Name]\"")
+	stages := make([]Stage, len(combinations))
+	for i, c := range combinations {
+		stages[i] = result
+		stages[i].Matrix = c
+	}
+	return stages
 }
 
-func parseTasks(script map[interface{}]interface{}) ([]Task, error) {
+// parseTasks - parses a single task or resolves an `include` entry in the tasks list
+// dependsOn receives the `depends_on` node of each task
+func (d *decoder) parseTasks(stage *Stage, dependsOn *[]nodeRef, node *yaml.Node) {
+	if ref := reference(node, "include"); ref != nil {
+		child, root := d.load(ref, "include", fragment(entries("stage", "tasks")))
+		if child != nil {
+			child.fragment(root, func(t *yaml.Node) {
+				child.parseTasks(stage, dependsOn, t)
+			})
+		}
+		return
+	}
+
+	if task, ok := d.parseTask(node); ok {
+		for _, t := range d.expand(task) {
+			stage.Tasks = append(stage.Tasks, t)
+			*dependsOn = append(*dependsOn, d.dependsOn[task])
+		}
+		delete(d.dependsOn, task)
+	}
+}
+
+// parseBlock - parses the tasks of an `on_failure` or `always` block
+func (d *decoder) parseBlock(node *yaml.Node, what string) []Task {
 	var result []Task
-	if tasks, ok := script["tasks"]; ok {
-		//fmt.Printf("tasks:\n%v\n\n", tasks)
-		for _, task := range tasks.([]interface{}) {
-			//fmt.Printf("task:\n%v\n\n", task)
-			_task, err := parseTask(task.(map[interface{}]interface{}))
-			if err != nil {
-				return result, err
+	d.sequence(node, what, func(t *yaml.Node) {
+		d.parseBlockTasks(&result, t, what)
+	})
+	return result
+}
+
+// parseBlockTasks - parses a single task or resolves an `include` entry in an `on_failure` or `always` block
+func (d *decoder) parseBlockTasks(tasks *[]Task, node *yaml.Node, what string) {
+	if ref := reference(node, "include"); ref != nil {
+		child, root := d.load(ref, "include", fragment(entries("stage", "on_failure")))
+		if child != nil {
+			child.fragment(root, func(t *yaml.Node) {
+				child.parseBlockTasks(tasks, t, what)
+			})
+		}
+		return
+	}
+
+	task, ok := d.parseTask(node)
+	if !ok {
+		return
+	}
+	if ref, ok := d.dependsOn[task]; ok {
+		delete(d.dependsOn, task)
+		d.errorf(ref.node, "tasks in `%s` cannot use depends_on", what)
+		return
+	}
+	*tasks = append(*tasks, d.expand(task)...)
+}
+
+// parseLoop - parses either a loop expression or a literal list of items
+func (d *decoder) parseLoop(task *Task, node *yaml.Node, what string) {
+	node = resolve(node)
+	if node.Kind == yaml.SequenceNode {
+		if items, ok := d.value(node, what); ok {
+			task.Items = items.([]interface{})
+		}
+		return
+	}
+
+	script, ok := d.str(node, what)
+	if !ok {
+		return
+	}
+
+	// `loop: "{{ list }}"` is accepted as well
+	task.Loop = d.expression(node, what, unwrap(script))
+}
+
+// parseOutputs - parses the expressions of the pipeline outputs in the order they have been declared
+func (d *decoder) parseOutputs(node *yaml.Node) []Output {
+	var result []Output
+	d.mapping(node, "outputs", func(key string, keyNode *yaml.Node, value *yaml.Node) {
+		if script, ok := d.str(value, "output `"+key+"`"); ok {
+			result = append(result, Output{
+				Name:   key,
+				Value:  d.expression(value, "output `"+key+"`", unwrap(script)),
+				Source: d.source(value),
+			})
+		}
+	})
+	return result
+}
+
+// source - returns the position of the node in the current file
+func (d *decoder) source(node *yaml.Node) Source {
+	node = resolve(node)
+	return Source{
+		File:   d.file,
+		Line:   node.Line,
+		Column: node.Column,
+	}
+}
+
+// expression - compiles the script, compile errors are reported at the node
+func (d *decoder) expression(node *yaml.Node, what string, script string) Expression {
+	expr := Expression{Script: script}
+	if err := expr.compile(d.programs); err != nil {
+		d.errorf(node, "invalid expression in %s `%s`: %s", what, script, compileError(err))
+	}
+	return expr
+}
+
+// templates - compiles all `{{ }}` expressions in the strings of the node
+func (d *decoder) templates(node *yaml.Node, what string) {
+	node = resolve(node)
+	switch node.Kind {
+	case yaml.ScalarNode:
+		for _, m := range templatePattern.FindAllString(node.Value, -1) {
+			d.expression(node, what, strings.TrimSpace(m[2:len(m)-2]))
+		}
+
+	case yaml.SequenceNode:
+		for _, child := range node.Content {
+			d.templates(child, what)
+		}
+
+	case yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			d.templates(node.Content[i], what)
+		}
+	}
+}
+
+// retryFilters - compiles the `retry_on` filters which are expressions
+func (d *decoder) retryFilters(node *yaml.Node, filters []string) {
+	node = resolve(node)
+	for i, filter := range filters {
+		at := node
+		if node.Kind == yaml.SequenceNode {
+			at = node.Content[i]
+		}
+		if !IsErrorClass(filter) {
+			d.expression(at, "retry_on", filter)
+		}
+	}
+}
+
+// unwrap - removes the optional `{{ }}` around an expression
+func unwrap(script string) string {
+	script = strings.TrimSpace(script)
+	if strings.HasPrefix(script, "{{") && strings.HasSuffix(script, "}}") {
+		script = strings.TrimSpace(script[2 : len(script)-2])
+	}
+	return script
+}
+
+// parseHandlers - parses a single handler or resolves an `include` entry in the handlers list
+func (d *decoder) parseHandlers(pipeline *Pipeline, node *yaml.Node) {
+	if ref := reference(node, "include"); ref != nil {
+		child, root := d.load(ref, "include", fragment(entries("pipeline", "handlers")))
+		if child != nil {
+			child.fragment(root, func(h *yaml.Node) {
+				child.parseHandlers(pipeline, h)
+			})
+		}
+		return
+	}
+
+	handler, ok := d.parseTask(node)
+	if !ok {
+		return
+	}
+	if handler.Name == "" {
+		d.errorf(node, "handler requires a name")
+		return
+	}
+	if ref, ok := d.dependsOn[handler]; ok {
+		delete(d.dependsOn, handler)
+		d.errorf(ref.node, "handlers cannot use depends_on")
+		return
+	}
+	if ref, ok := d.matrices[handler]; ok {
+		delete(d.matrices, handler)
+		d.errorf(ref.node, "handlers cannot use matrix")
+		return
+	}
+	if pipeline.Handler(handler.Name) != nil {
+		d.errorf(node, "duplicate handler `%s`", handler.Name)
+		return
+	}
+	pipeline.Handlers = append(pipeline.Handlers, *handler)
+}
+
+// checkNotifies - reports all `notify` entries that do not reference a handler
+func (d *decoder) checkNotifies(pipeline *Pipeline) {
+	for _, ref := range d.notifies {
+		node := resolve(ref.node)
+		entries := []*yaml.Node{node}
+		if node.Kind == yaml.SequenceNode {
+			entries = node.Content
+		}
+		for _, entry := range entries {
+			entry = resolve(entry)
+			if entry.Kind == yaml.ScalarNode && pipeline.Handler(entry.Value) == nil {
+				ref.decoder.errorf(entry, "unknown handler `%s`", entry.Value)
 			}
-			result = append(result, *_task)
 		}
 	}
-	return result, nil
 }
 
-func parseTask(script map[interface{}]interface{}) (*Task, error) {
-	result := &Task{}
+// Handler - returns the handler with the given name or nil
+func (p *Pipeline) Handler(name string) *Task {
+	for i := range p.Handlers {
+		if p.Handlers[i].Name == name {
+			return &p.Handlers[i]
+		}
+	}
+	return nil
+}
 
-	for key, value := range script {
-		switch key.(string) {
+func (d *decoder) parseTask(node *yaml.Node) (*Task, bool) {
+	result := &Task{
+		Source: d.source(node),
+	}
+
+	node = resolve(node)
+	if node.Kind != yaml.MappingNode {
+		return nil, false
+	}
+
+	start := len(d.diags)
+	var input, inputKey *yaml.Node
+	d.mapping(node, "task", func(key string, keyNode *yaml.Node, value *yaml.Node) {
+		switch key {
 		case "name":
-			result.Name = value.(string)
-			break
+			result.Name, _ = d.str(value, key)
 
 		case "service":
-			if v, ok := value.(string); ok {
-				result.Service = v
-			} else if v, ok := value.(map[interface{}]interface{}); ok {
-				params := make(map[string]interface{})
-				for k, v := range v {
-					if k.(string) == "name" {
-						result.Service = v.(string)
-					} else {
-						params[k.(string)] = v
-					}
-				}
-				if result.Service == "" {
-					return nil, errors.New("Invalid syntax when parsing \"service\", missing \"name\"")
-				}
-				result.Parameters = params
-			} else {
-				return nil, errors.New("Invalid syntax when parsing \"service\"")
-			}
-			break
+			d.parseService(result, value)
+
+		case "input":
+			input, inputKey = value, keyNode
+
+		case "pipeline":
+			d.parseSubPipeline(result, value)
+
+		case "set_fact":
+			d.parseSetFact(result, value)
+
+		case "assert":
+			d.parseAssert(result, value)
+
+		case "fail":
+			d.parseFail(result, value)
 
 		case "ignore_errors":
-			result.IgnoreErrors = strings.ToLower(value.(string)) == "true"
-			break
+			result.IgnoreErrors, _ = d.bool(value, key)
 
 		case "register":
-			result.Register = value.(string)
-			break
+			result.Register, _ = d.str(value, key)
 
 		case "notify":
-			if val, ok := value.(string); ok {
-				result.Notify = []string{val}
-			} else if list, ok := value.([]interface{}); ok {
-				for _, val := range list {
-					if str, ok := val.(string); ok {
-						result.Notify = append(result.Notify, str)
-					} else {
-						return nil, errors.New("Invalid syntax when parsing \"notify\". Should be a string or a list of strings")
-					}
+			result.Notify, _ = d.strList(value, key)
+			d.notifies = append(d.notifies, nodeRef{d, value})
+
+		case "when":
+			if script, ok := d.str(value, key); ok {
+				result.When = d.expression(value, key, script)
+			}
+
+		case "vars":
+			result.Variables = d.parseVariables(value)
+
+		case "depends_on":
+			result.DependsOn, _ = d.strList(value, key)
+			d.dependsOn[result] = nodeRef{d, value}
+
+		case "timeout":
+			result.Timeout, _ = d.duration(value, key)
+
+		case "retries":
+			if retries, ok := d.int(value, key); ok {
+				result.Retry.Retries = &retries
+			}
+
+		case "retry_delay":
+			result.Retry.Delay, _ = d.duration(value, key)
+
+		case "backoff":
+			if backoff, ok := d.str(value, key); ok {
+				result.Retry.Backoff = Backoff(backoff)
+			}
+
+		case "retry_on":
+			result.Retry.On, _ = d.strList(value, key)
+			d.retryFilters(value, result.Retry.On)
+
+		case "matrix":
+			if combinations, ok := d.parseMatrix(value); ok {
+				d.matrices[result] = matrixRef{value, combinations}
+			}
+
+		case "loop", "with_items":
+			if result.Loop.Script != "" || result.Items != nil {
+				d.errorf(keyNode, "only one of `loop` and `with_items` can be used")
+				return
+			}
+			d.parseLoop(result, value, key)
+
+		default:
+			// the schema only allows services of the catalog besides the keys above
+			result.Service = key
+			d.parseInput(result, value)
+		}
+	})
+	switch {
+	case input == nil:
+	case result.Service == "":
+		d.errorf(inputKey, "`input` can only be used with `service`")
+	default:
+		d.parseInput(result, input)
+	}
+
+	return result, len(d.diags) == start
+}
+
+// parseParameter - parses either a plain parameter name or a full parameter declaration
+func (d *decoder) parseParameter(node *yaml.Node) (Parameter, bool) {
+	result := Parameter{
+		Type: StringParameter,
+	}
+
+	node = resolve(node)
+	if node.Kind == yaml.ScalarNode {
+		result.Name, _ = d.str(node, "parameter name")
+		return result, result.Name != ""
+	}
+
+	start := len(d.diags)
+	var defaultNode *yaml.Node
+	var enumNodes []*yaml.Node
+	d.mapping(node, "parameter", func(key string, keyNode *yaml.Node, value *yaml.Node) {
+		switch key {
+		case "name":
+			result.Name, _ = d.str(value, key)
+
+		case "type":
+			if t, ok := d.str(value, key); ok {
+				result.Type = ParameterType(t)
+			}
+
+		case "description":
+			result.Description, _ = d.str(value, key)
+
+		case "default":
+			defaultNode = value
+
+		case "required":
+			result.Required, _ = d.bool(value, key)
+
+		case "enum":
+			d.sequence(value, key, func(e *yaml.Node) {
+				enumNodes = append(enumNodes, e)
+			})
+
+		case "pattern":
+			if pattern, ok := d.str(value, key); ok {
+				if _, err := regexp.Compile(pattern); err != nil {
+					d.errorf(value, "invalid pattern: %s", err)
 				}
-			} else {
-				return nil, errors.New("Invalid syntax when parsing \"notify\"")
+				result.Pattern = pattern
 			}
-			break
+		}
+	})
 
-		case "when":
-			result.When = Expression{
-				Script: value.(string),
+	// defaults and enum values are checked against the declared type
+	if defaultNode != nil {
+		result.Default = d.parameterValue(&result, defaultNode, "default")
+	}
+	for _, e := range enumNodes {
+		if v := d.parameterValue(&result, e, "enum value"); v != nil {
+			result.Enum = append(result.Enum, v)
+		}
+	}
+
+	return result, len(d.diags) == start
+}
+
+func (d *decoder) parameterValue(param *Parameter, node *yaml.Node, what string) interface{} {
+	value, ok := d.value(node, what)
+	if !ok {
+		return nil
+	}
+	if !containsType(ParameterTypes, param.Type) {
+		return value
+	}
+	v, err := param.Type.Coerce(value)
+	if err != nil {
+		d.errorf(node, "%s %s", what, err)
+		return nil
+	}
+	return v
+}
+
+// parseVariables - parses a `vars` block, the order of declaration is preserved
+func (d *decoder) parseVariables(node *yaml.Node) []Variable {
+	var result []Variable
+	d.mapping(node, "vars", func(key string, keyNode *yaml.Node, value *yaml.Node) {
+		if v, ok := d.str(value, "variable `"+key+"`"); ok {
+			d.templates(value, "variable `"+key+"`")
+			result = append(result, Variable{
+				Name:   key,
+				Value:  v,
+				Source: d.source(value),
+			})
+		}
+	})
+	return result
+}
+
+func (d *decoder) parseService(task *Task, node *yaml.Node) {
+	node = resolve(node)
+	switch node.Kind {
+	case yaml.ScalarNode:
+		task.Service, _ = d.str(node, "service")
+
+	case yaml.MappingNode:
+		params := make(map[string]interface{})
+		d.mapping(node, "service", func(key string, keyNode *yaml.Node, value *yaml.Node) {
+			if key == "name" {
+				task.Service, _ = d.str(value, "service name")
+				return
 			}
-			break
+			if v, ok := d.value(value, "input `"+key+"`"); ok {
+				d.templates(value, "input `"+key+"`")
+				params[key] = v
+			}
+		})
+		task.Parameters = params
+	}
+}
+
+// parseInput - parses the inputs of a service given as `input` or as `<service>: <inputs>`
+// a string is assigned to the default input of the service, a mapping is merged into the inputs
+func (d *decoder) parseInput(task *Task, node *yaml.Node) {
+	if task.Parameters == nil {
+		task.Parameters = make(map[string]interface{})
+	}
 
+	node = resolve(node)
+	if node.Kind == yaml.ScalarNode {
+		var service *Service
+		if d.catalog != nil {
+			service = d.catalog.Service(task.Service)
+		}
+		switch {
+		case service == nil:
+			d.errorf(node, "unknown service `%s`, the input of a service which is not in the catalog has to be a mapping", task.Service)
+		case service.Input == "":
+			d.errorf(node, "service `%s` has no default input, its input has to be a mapping", task.Service)
 		default:
-			break
+			d.setInput(task, node, service.Input)
 		}
+		return
 	}
 
-	// TODO: sanitize task
-	if result.Service == "" {
-		return nil, errors.New("task requires a service")
+	d.mapping(node, "input", func(key string, keyNode *yaml.Node, value *yaml.Node) {
+		d.setInput(task, value, key)
+	})
+}
+
+func (d *decoder) setInput(task *Task, node *yaml.Node, key string) {
+	if _, ok := task.Parameters[key]; ok {
+		d.errorf(node, "input `%s` of service `%s` is set more than once", key, task.Service)
+		return
+	}
+	if v, ok := d.value(node, "input `"+key+"`"); ok {
+		d.templates(node, "input `"+key+"`")
+		task.Parameters[key] = v
 	}
+}
 
-	return result, nil
+// parseSubPipeline - parses the reference to a sub-pipeline, all keys except `name` are passed as its parameters
+func (d *decoder) parseSubPipeline(task *Task, node *yaml.Node) {
+	node = resolve(node)
+	var ref *yaml.Node
+	switch node.Kind {
+	case yaml.ScalarNode:
+		ref = node
+
+	case yaml.MappingNode:
+		params := make(map[string]interface{})
+		d.mapping(node, "pipeline", func(key string, keyNode *yaml.Node, value *yaml.Node) {
+			if key == "name" {
+				ref = value
+				return
+			}
+			if v, ok := d.value(value, "input `"+key+"`"); ok {
+				d.templates(value, "input `"+key+"`")
+				params[key] = v
+			}
+		})
+		if ref == nil {
+			return
+		}
+		task.Parameters = params
+
+	default:
+		return
+	}
+
+	task.Pipeline = d.loadPipeline(ref)
+}
+
+// loadPipeline - parses the referenced pipeline once and returns its key in the pipelines of the root pipeline
+// pipelines are allowed to reference themselves, the depth of the recursion is limited when they are executed
+func (d *decoder) loadPipeline(node *yaml.Node) string {
+	ref, ok := d.str(node, "pipeline")
+	if !ok {
+		return ""
+	}
+
+	if d.loader == nil {
+		d.errorf(node, "unable to resolve pipeline `%s`, no loader configured", ref)
+		return ""
+	}
+
+	file, data, err := d.loader.Load(d.file, ref)
+	if err != nil {
+		d.errorf(node, "unable to load pipeline `%s`: %s", ref, err)
+		return ""
+	}
+	if _, ok := d.pipelines[file]; ok {
+		return file
+	}
+
+	// the entry is registered before parsing so recursive references resolve to it
+	sub := &Pipeline{}
+	d.pipelines[file] = sub
+
+	child := &decoder{
+		parseState: d.parseState,
+		file:       file,
+		stack:      []string{file},
+	}
+	root := child.document(data)
+	if root == nil || !child.validate(root, definition("pipeline"), "pipeline") {
+		return ""
+	}
+
+	// notifies are only checked against the handlers of the pipeline they have been declared in
+	notifies := d.notifies
+	d.notifies = nil
+	*sub = *child.parsePipeline(root)
+	child.checkNotifies(sub)
+	d.notifies = notifies
+
+	return file
+}
+
+// resolve - follows yaml aliases to the node they are referencing
+func resolve(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	return node
+}
+
+// findKey - returns the value for the given key in a mapping node
+func findKey(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// mapping - invokes fn for every key/value pair of a mapping node and reports duplicate keys
+func (d *decoder) mapping(node *yaml.Node, what string, fn func(key string, keyNode *yaml.Node, value *yaml.Node)) bool {
+	node = resolve(node)
+	if node.Kind != yaml.MappingNode {
+		d.errorf(node, "%s must be a mapping", what)
+		return false
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode := node.Content[i]
+		if keyNode.Kind != yaml.ScalarNode {
+			d.errorf(keyNode, "keys in %s must be strings", what)
+			continue
+		}
+		if seen[keyNode.Value] {
+			d.errorf(keyNode, "duplicate key `%s` in %s", keyNode.Value, what)
+			continue
+		}
+		seen[keyNode.Value] = true
+		fn(keyNode.Value, keyNode, node.Content[i+1])
+	}
+	return true
+}
+
+// sequence - invokes fn for every entry of a sequence node
+func (d *decoder) sequence(node *yaml.Node, what string, fn func(*yaml.Node)) bool {
+	node = resolve(node)
+	if node.Kind != yaml.SequenceNode {
+		d.errorf(node, "%s must be a list", what)
+		return false
+	}
+	for _, entry := range node.Content {
+		fn(entry)
+	}
+	return true
+}
+
+func (d *decoder) str(node *yaml.Node, what string) (string, bool) {
+	node = resolve(node)
+	if node.Kind != yaml.ScalarNode || node.Tag == "!!null" {
+		d.errorf(node, "%s must be a string", what)
+		return "", false
+	}
+	return node.Value, true
+}
+
+func (d *decoder) bool(node *yaml.Node, what string) (bool, bool) {
+	node = resolve(node)
+	if node.Kind == yaml.ScalarNode {
+		switch node.Tag {
+		case "!!bool":
+			var b bool
+			if err := node.Decode(&b); err == nil {
+				return b, true
+			}
+		case "!!str":
+			// quoted booleans are accepted for backwards compatibility
+			switch strings.ToLower(node.Value) {
+			case "true":
+				return true, true
+			case "false":
+				return false, true
+			}
+		}
+	}
+	d.errorf(node, "%s must be a bool", what)
+	return false, false
+}
+
+func (d *decoder) int(node *yaml.Node, what string) (int, bool) {
+	node = resolve(node)
+	if node.Kind == yaml.ScalarNode {
+		switch node.Tag {
+		case "!!int":
+			var i int
+			if err := node.Decode(&i); err == nil {
+				return i, true
+			}
+		case "!!str":
+			// quoted integers are accepted like quoted booleans
+			if i, err := strconv.Atoi(node.Value); err == nil {
+				return i, true
+			}
+		}
+	}
+	d.errorf(node, "%s must be an int", what)
+	return 0, false
+}
+
+func (d *decoder) duration(node *yaml.Node, what string) (Duration, bool) {
+	if s, ok := d.str(node, what); ok {
+		v, err := time.ParseDuration(s)
+		if err == nil && v >= 0 {
+			return Duration(v), true
+		}
+		d.errorf(node, "%s must be a duration like `30s` or `1h30m`", what)
+	}
+	return 0, false
+}
+
+// value - converts the node into plain go values, maps must only have string keys
+// scalars keep their yaml type, so numbers and bools are not converted into strings
+func (d *decoder) value(node *yaml.Node, what string) (interface{}, bool) {
+	node = resolve(node)
+	switch node.Kind {
+	case yaml.ScalarNode:
+		var v interface{}
+		if err := node.Decode(&v); err != nil {
+			d.errorf(node, "invalid %s: %s", what, err)
+			return nil, false
+		}
+		return v, true
+
+	case yaml.SequenceNode:
+		result := make([]interface{}, 0, len(node.Content))
+		ok := true
+		for _, entry := range node.Content {
+			v, valid := d.value(entry, what)
+			result = append(result, v)
+			ok = ok && valid
+		}
+		return result, ok
+
+	case yaml.MappingNode:
+		result := make(map[string]interface{})
+		ok := true
+		d.mapping(node, what, func(key string, keyNode *yaml.Node, value *yaml.Node) {
+			v, valid := d.value(value, what)
+			result[key] = v
+			ok = ok && valid
+		})
+		return result, ok
+	}
+
+	d.errorf(node, "invalid %s", what)
+	return nil, false
+}
+
+// strList - accepts either a single string or a list of strings
+func (d *decoder) strList(node *yaml.Node, what string) ([]string, bool) {
+	node = resolve(node)
+	if node.Kind == yaml.ScalarNode {
+		s, ok := d.str(node, what)
+		if !ok {
+			return nil, false
+		}
+		return []string{s}, true
+	}
+
+	if node.Kind != yaml.SequenceNode {
+		d.errorf(node, "%s must be a string or a list of strings", what)
+		return nil, false
+	}
+
+	var result []string
+	ok := true
+	for _, entry := range node.Content {
+		if s, valid := d.str(entry, "entries in "+what); valid {
+			result = append(result, s)
+		} else {
+			ok = false
+		}
+	}
+	return result, ok
+}
+
+func containsType(list []ParameterType, value ParameterType) bool {
+	for _, entry := range list {
+		if entry == value {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(list []string, value string) bool {
+	for _, entry := range list {
+		if entry == value {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,89 @@
+package pipeline
+
+import (
+	"time"
+)
+
+// Backoff - Describes how the delay between retries grows
+type Backoff string
+
+const (
+	// FixedBackoff - every retry waits for the retry delay
+	FixedBackoff Backoff = "fixed"
+	// LinearBackoff - the n-th retry waits for n times the retry delay
+	LinearBackoff Backoff = "linear"
+	// ExponentialBackoff - the n-th retry waits for 2^(n-1) times the retry delay
+	ExponentialBackoff Backoff = "exponential"
+)
+
+// Backoffs - all supported backoff strategies
+var Backoffs = []Backoff{
+	FixedBackoff,
+	LinearBackoff,
+	ExponentialBackoff,
+}
+
+// error classes which can be used in `retry_on`
+const (
+	// TimeoutErrorClass - the task did not finish within its timeout
+	TimeoutErrorClass = "timeout"
+	// FailureErrorClass - the service reported that the task failed
+	FailureErrorClass = "failure"
+	// DispatchErrorClass - any other error while dispatching the task
+	DispatchErrorClass = "error"
+)
+
+// IsErrorClass - checks if the `retry_on` filter is an error class instead of an expression
+func IsErrorClass(filter string) bool {
+	switch filter {
+	case TimeoutErrorClass, FailureErrorClass, DispatchErrorClass:
+		return true
+	}
+	return false
+}
+
+// defaultRetryDelay - the delay between retries if the task does not specify `retry_delay`
+const defaultRetryDelay = Duration(time.Second)
+
+// MaxRetries - the amount of retries a task can declare
+const MaxRetries = 100
+
+// MaxRetryDelay - the longest delay between two retries, the delay of a backoff stops growing once it is reached
+const MaxRetryDelay = time.Hour
+
+// RetryPolicy - Describes how often and on which errors a failed task is retried
+// `On` contains either error classes or expressions, an empty list retries on all errors
+// `Retries` is nil if the task does not declare `retries`, the executor decides how often it is retried
+type RetryPolicy struct {
+	Retries *int     `json:"retries,omitempty" bson:"retries,omitempty"`
+	Delay   Duration `json:"retry_delay" bson:"retry_delay" swaggertype:"string"`
+	Backoff Backoff  `json:"backoff" bson:"backoff"`
+	On      []string `json:"retry_on" bson:"retry_on"`
+}
+
+// DelayFor - returns the time to wait before the given retry (starting at 1), at most MaxRetryDelay
+func (r *RetryPolicy) DelayFor(retry int) time.Duration {
+	delay := time.Duration(r.Delay)
+	if r.Delay == 0 {
+		delay = time.Duration(defaultRetryDelay)
+	}
+	if retry < 1 {
+		retry = 1
+	}
+
+	// the factor is checked before multiplying so the delay cannot overflow
+	factor := int64(1)
+	switch r.Backoff {
+	case LinearBackoff:
+		factor = int64(retry)
+	case ExponentialBackoff:
+		if retry > 62 {
+			return MaxRetryDelay
+		}
+		factor = int64(1) << uint(retry-1)
+	}
+	if delay >= MaxRetryDelay || factor > int64(MaxRetryDelay/delay) {
+		return MaxRetryDelay
+	}
+	return delay * time.Duration(factor)
+}
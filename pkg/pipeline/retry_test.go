@@ -0,0 +1,78 @@
+package pipeline
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDelayFor(t *testing.T) {
+	second := Duration(time.Second)
+	delays := map[Backoff][]time.Duration{
+		FixedBackoff:       {time.Second, time.Second, time.Second, time.Second},
+		LinearBackoff:      {time.Second, 2 * time.Second, 3 * time.Second, 4 * time.Second},
+		ExponentialBackoff: {time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second},
+	}
+	for backoff, expects := range delays {
+		policy := RetryPolicy{Delay: second, Backoff: backoff}
+		for i, delay := range expects {
+			if result := policy.DelayFor(i + 1); result != delay {
+				t.Errorf("%s backoff waits %s before retry %d, expected %s", backoff, result, i+1, delay)
+			}
+		}
+	}
+
+	// tasks without `retry_delay` or `backoff` wait a second before each retry
+	var policy RetryPolicy
+	if delay := policy.DelayFor(3); delay != time.Second {
+		t.Errorf("default policy waits %s, expected 1s", delay)
+	}
+}
+
+func TestDelayIsCapped(t *testing.T) {
+	policies := []RetryPolicy{
+		{Delay: Duration(48 * time.Hour)},
+		{Delay: Duration(time.Minute), Backoff: LinearBackoff},
+		{Delay: Duration(time.Second), Backoff: ExponentialBackoff},
+	}
+	for _, policy := range policies {
+		// large retries must neither overflow nor exceed the maximum
+		for _, retry := range []int{61, 62, 63, 64, 100, 1 << 30} {
+			if delay := policy.DelayFor(retry); delay != MaxRetryDelay {
+				t.Errorf("%+v waits %s before retry %d, expected %s", policy, delay, retry, MaxRetryDelay)
+			}
+		}
+	}
+
+	var policy RetryPolicy
+	if delay := policy.DelayFor(0); delay != time.Second {
+		t.Errorf("DelayFor(0) = %s, expected the delay of the first retry", delay)
+	}
+}
+
+func TestParseRetryPolicy(t *testing.T) {
+	p, err := CreateFromBytes(`---
+stages:
+- stage: s
+  tasks:
+  - name: upload
+    service: shell
+    retries: 3
+    retry_delay: 1m30s
+    backoff: linear
+    retry_on: [timeout, attempt < 2]
+`)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	retry := p.Stages[0].Tasks[0].Retry
+	if retry.Retries == nil || *retry.Retries != 3 || retry.Delay != Duration(90*time.Second) || retry.Backoff != LinearBackoff || len(retry.On) != 2 {
+		t.Errorf("retry policy = %+v", retry)
+	}
+
+	for _, invalid := range []string{"retries: -1", "retries: 101", "retry_delay: soon", "backoff: random"} {
+		_, err := CreateFromBytes("---\nstages:\n- stage: s\n  tasks:\n  - name: upload\n    service: shell\n    " + invalid + "\n")
+		if err == nil {
+			t.Errorf("`%s` has been accepted", invalid)
+		}
+	}
+}
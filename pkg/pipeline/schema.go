@@ -0,0 +1,411 @@
+package pipeline
+
+import (
+	"encoding/json"
+)
+
+// SchemaDraft - the version of JSON Schema used by NewSchema
+const SchemaDraft = "http://json-schema.org/draft-07/schema#"
+
+// Schema - A JSON Schema document, only the keywords needed to describe pipeline scripts are supported
+type Schema struct {
+	Schema      string             `json:"$schema,omitempty"`
+	Ref         string             `json:"$ref,omitempty"`
+	Title       string             `json:"title,omitempty"`
+	Description string             `json:"description,omitempty"`
+	Type        SchemaTypes        `json:"type,omitempty"`
+	Properties  map[string]*Schema `json:"properties,omitempty"`
+	// either false to forbid unknown keys or the schema of all unknown keys, nil allows any key
+	AdditionalProperties interface{}        `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Minimum              *int               `json:"minimum,omitempty"`
+	Maximum              *int               `json:"maximum,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+	Definitions          map[string]*Schema `json:"definitions,omitempty"`
+
+	order      []string // keys of Properties in their canonical order
+	unknownKey string   // explains which keys are allowed besides Properties
+}
+
+// SchemaTypes - the allowed json types of a value
+type SchemaTypes []string
+
+// MarshalJSON - writes a single type as a plain string
+func (t SchemaTypes) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+// parserSchema - the schema of all keys which do not depend on a service catalog, services are not restricted
+var parserSchema = newSchema(nil, nil)
+
+// durationPattern - matches the durations accepted by time.ParseDuration
+const durationPattern = `^([0-9]+(\.[0-9]*)?(ns|us|µs|ms|s|m|h))+$`
+
+// boolPattern - quoted booleans are accepted for backwards compatibility
+const boolPattern = `^([Tt][Rr][Uu][Ee]|[Ff][Aa][Ll][Ss][Ee])$`
+
+// intPattern - quoted integers are accepted like quoted booleans
+const intPattern = `^[+-]?[0-9]+$`
+
+// NewSchema - builds the JSON Schema of pipeline scripts
+// if a catalog is given services are restricted to the services of the catalog and can be used as keys of a task
+func NewSchema(catalog *ServiceCatalog) *Schema {
+	return newSchema(catalog, catalog)
+}
+
+// newSchema - services are restricted to the services of the restrict catalog,
+// the services of the shorthands catalog can be used as keys of a task
+func newSchema(restrict *ServiceCatalog, shorthands *ServiceCatalog) *Schema {
+	var services []interface{}
+	if restrict != nil {
+		for _, name := range restrict.ServiceNames() {
+			services = append(services, name)
+		}
+	}
+
+	var backoffs, failurePolicies, parameterTypes []interface{}
+	for _, b := range Backoffs {
+		backoffs = append(backoffs, string(b))
+	}
+	for _, p := range FailurePolicies {
+		failurePolicies = append(failurePolicies, string(p))
+	}
+	for _, t := range ParameterTypes {
+		parameterTypes = append(parameterTypes, string(t))
+	}
+
+	tasks := list(anyOf(definition("include"), definition("task")))
+
+	taskProps := []property{
+		prop("name", str("name of the task")),
+		prop("service", definition("service")),
+		prop("input", anyOf(
+			str("input of the service, it is assigned to the default input of the service"),
+			mapOf(&Schema{Description: "inputs of the service"}),
+		)),
+		prop("pipeline", definition("call")),
+		prop("set_fact", mapOf(&Schema{Description: "value of the variable, `{{ }}` expressions are evaluated"})),
+		prop("assert", definition("assert")),
+		prop("fail", definition("fail")),
+		prop("when", &Schema{
+			Description: "the task is skipped unless the expression is true",
+			Type:        SchemaTypes{"string", "boolean"},
+		}),
+		prop("loop", str("expression of a list or map to run the task for")),
+		prop("with_items", &Schema{
+			Description: "list of items to run the task for",
+			Type:        SchemaTypes{"array"},
+		}),
+		prop("matrix", definition("matrix")),
+		prop("vars", definition("vars")),
+		prop("depends_on", strList("tasks of the stage which have to succeed first")),
+		prop("register", str("variable the result of the task is stored in")),
+		prop("notify", strList("handlers to run if the task succeeded")),
+		prop("ignore_errors", boolean("")),
+		prop("timeout", duration("timeout of each attempt")),
+		prop("retries", between(integer("amount of retries after the first attempt, tasks of services are retried 3 times by default"), 0, MaxRetries)),
+		prop("retry_delay", duration("delay before the first retry")),
+		prop("backoff", enum(str("how the delay grows between retries"), backoffs)),
+		prop("retry_on", strList("error classes or expressions which are retried")),
+	}
+	taskKinds := []*Schema{
+		required(&Schema{}, "service"), required(&Schema{}, "pipeline"),
+		required(&Schema{}, string(SetFactTask)), required(&Schema{}, string(AssertTask)), required(&Schema{}, string(FailTask)),
+	}
+	// every service of the catalog can be used as a key of the task, e.g. `shell: ls`
+	if shorthands != nil {
+		for _, service := range shorthands.Services {
+			if containsProperty(taskProps, service.Name) {
+				continue
+			}
+			taskProps = append(taskProps, prop(service.Name, shorthand(service)))
+			taskKinds = append(taskKinds, required(&Schema{}, service.Name))
+		}
+	}
+	task := oneOf(object("task", "", taskProps...), taskKinds...)
+	task.unknownKey = "it is neither a key of a task nor a service of the catalog"
+
+	return &Schema{
+		Schema: SchemaDraft,
+		Title:  "dips pipeline",
+		Ref:    "#/definitions/pipeline",
+		Definitions: map[string]*Schema{
+			"pipeline": object("pipeline", "",
+				prop("name", str("name of the pipeline")),
+				prop("parameters", list(definition("parameter"))),
+				prop("vars", definition("vars")),
+				prop("timeout", duration("deadline of the whole job")),
+				prop("stages", list(anyOf(definition("include"), definition("import"), definition("stage")))),
+				prop("handlers", tasks),
+				prop("on_failure", tasks),
+				prop("always", tasks),
+				prop("outputs", mapOf(str("expression of the output"))),
+			),
+
+			"stage": required(object("stage", "",
+				prop("stage", str("name of the stage")),
+				prop("matrix", definition("matrix")),
+				prop("vars", definition("vars")),
+				prop("when", &Schema{
+					Description: "the stage is skipped unless the expression is true",
+					Type:        SchemaTypes{"string", "boolean"},
+				}),
+				prop("until", str("the stage is repeated until the expression is true")),
+				prop("max_iterations", atLeast(integer("amount of times the stage is run at most while `until` is false"), 1)),
+				prop("delay", duration("delay between two iterations of the stage")),
+				prop("parallel", boolean("dispatch the tasks of the stage concurrently")),
+				prop("max_parallel", atLeast(integer("amount of tasks which are dispatched at once"), 1)),
+				prop("failure_policy", enum(str("what happens to the remaining tasks once a task failed"), failurePolicies)),
+				prop("flush_handlers", boolean("run notified handlers at the end of this stage")),
+				prop("tasks", tasks),
+				prop("on_failure", tasks),
+				prop("always", tasks),
+			), "stage"),
+
+			"task": task,
+
+			"service": anyOf(
+				enum(str("name of the service"), services),
+				required(object("service", "a service with its inputs",
+					prop("name", enum(str("name of the service"), services)),
+				), "name").open(&Schema{}),
+			),
+
+			"call": anyOf(
+				str("name of the pipeline"),
+				required(object("pipeline", "a pipeline with its inputs",
+					prop("name", str("name of the pipeline")),
+				), "name").open(&Schema{}),
+			),
+
+			"assert": anyOf(
+				strList("conditions which all have to be true"),
+				required(object("assert", "",
+					prop("that", strList("conditions which all have to be true")),
+					prop("message", str("message of the failure if a condition is false")),
+				), "that"),
+			),
+
+			"fail": anyOf(
+				str("message of the failure"),
+				required(object("fail", "",
+					prop("message", str("message of the failure")),
+				), "message"),
+			),
+
+			"matrix": object("matrix", "runs a copy for every combination of the values, each combination is available as `matrix`",
+				prop("include", list(mapOf(&Schema{}))),
+				prop("exclude", list(mapOf(&Schema{}))),
+			).open(list(&Schema{})),
+
+			"parameter": anyOf(
+				str("name of a string parameter"),
+				required(object("parameter", "",
+					prop("name", str("name of the parameter")),
+					prop("type", enum(str(""), parameterTypes)),
+					prop("description", str("")),
+					prop("default", &Schema{}),
+					prop("required", boolean("")),
+					prop("enum", list(&Schema{})),
+					prop("pattern", str("regular expression the value has to match")),
+				), "name"),
+			),
+
+			"vars": mapOf(&Schema{
+				Description: "value of the variable, `{{ }}` expressions are evaluated",
+				Type:        SchemaTypes{"string", "number", "boolean"},
+			}),
+
+			"include": required(object("include", "",
+				prop("include", str("file whose entries are inserted")),
+			), "include"),
+
+			"import": required(object("import", "",
+				prop("import", str("pipeline whose stages are inserted")),
+			), "import"),
+		},
+	}
+}
+
+// Keys - returns the keys of the definition in their canonical order
+// the keys of definitions with alternatives are taken from the first alternative which is an object
+func (s *Schema) Keys(name string) []string {
+	def, ok := s.Definitions[name]
+	if !ok {
+		return nil
+	}
+	for _, alt := range def.AnyOf {
+		if len(alt.order) > 0 {
+			return alt.order
+		}
+	}
+	return def.order
+}
+
+// properties - returns the properties of the definition, definitions with alternatives are handled like in Keys
+func (s *Schema) properties(name string) map[string]*Schema {
+	def, ok := s.Definitions[name]
+	if !ok {
+		return nil
+	}
+	for _, alt := range def.AnyOf {
+		if len(alt.Properties) > 0 {
+			return alt.Properties
+		}
+	}
+	return def.Properties
+}
+
+// quoted - checks if one of the alternatives of the schema accepts quoted values of the given pattern, e.g. boolPattern
+func (s *Schema) quoted(pattern string) bool {
+	for _, alt := range s.AnyOf {
+		if alt.Pattern == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// shorthand - the schema of a service which is used as a key of a task,
+// it takes either a mapping of inputs or a string for its default input
+func shorthand(service Service) *Schema {
+	inputs := mapOf(&Schema{Description: "inputs of the service"})
+	inputs.Description = service.Description
+	if service.Input == "" {
+		return inputs
+	}
+	return anyOf(str("`"+service.Input+"` of the service"), inputs)
+}
+
+func containsProperty(props []property, key string) bool {
+	for _, p := range props {
+		if p.key == key {
+			return true
+		}
+	}
+	return false
+}
+
+type property struct {
+	key    string
+	schema *Schema
+}
+
+func prop(key string, schema *Schema) property {
+	return property{key, schema}
+}
+
+// object - a mapping which only allows the given keys
+func object(title string, description string, props ...property) *Schema {
+	s := &Schema{
+		Title:                title,
+		Description:          description,
+		Type:                 SchemaTypes{"object"},
+		Properties:           make(map[string]*Schema, len(props)),
+		AdditionalProperties: false,
+	}
+	for _, p := range props {
+		s.Properties[p.key] = p.schema
+		s.order = append(s.order, p.key)
+	}
+	return s
+}
+
+// open - allows additional keys matching the schema
+func (s *Schema) open(additional *Schema) *Schema {
+	s.AdditionalProperties = additional
+	return s
+}
+
+func mapOf(values *Schema) *Schema {
+	return &Schema{
+		Type:                 SchemaTypes{"object"},
+		AdditionalProperties: values,
+	}
+}
+
+func list(items *Schema) *Schema {
+	return &Schema{
+		Type:  SchemaTypes{"array"},
+		Items: items,
+	}
+}
+
+func str(description string) *Schema {
+	return &Schema{
+		Description: description,
+		Type:        SchemaTypes{"string"},
+	}
+}
+
+func integer(description string) *Schema {
+	return anyOf(
+		&Schema{Description: description, Type: SchemaTypes{"integer"}},
+		&Schema{Type: SchemaTypes{"string"}, Pattern: intPattern},
+	)
+}
+
+func boolean(description string) *Schema {
+	return anyOf(
+		&Schema{Description: description, Type: SchemaTypes{"boolean"}},
+		&Schema{Type: SchemaTypes{"string"}, Pattern: boolPattern},
+	)
+}
+
+func duration(description string) *Schema {
+	return &Schema{
+		Description: description + ", e.g. `30s` or `1h30m`",
+		Type:        SchemaTypes{"string"},
+		Pattern:     durationPattern,
+	}
+}
+
+func strList(description string) *Schema {
+	return anyOf(str(description), list(str("")))
+}
+
+func definition(name string) *Schema {
+	return &Schema{
+		Ref: "#/definitions/" + name,
+	}
+}
+
+func anyOf(schemas ...*Schema) *Schema {
+	return &Schema{
+		AnyOf: schemas,
+	}
+}
+
+// oneOf - the value has to match the schema and exactly one of the alternatives
+func oneOf(s *Schema, alternatives ...*Schema) *Schema {
+	s.OneOf = alternatives
+	return s
+}
+
+func required(s *Schema, keys ...string) *Schema {
+	s.Required = append(s.Required, keys...)
+	return s
+}
+
+func enum(s *Schema, values []interface{}) *Schema {
+	s.Enum = values
+	return s
+}
+
+func atLeast(s *Schema, min int) *Schema {
+	s.Minimum = &min
+	return s
+}
+
+func between(s *Schema, min int, max int) *Schema {
+	s.Minimum = &min
+	s.Maximum = &max
+	return s
+}
@@ -0,0 +1,202 @@
+package pipeline
+
+import (
+	"regexp"
+	"strings"
+)
+
+// templatePattern - matches the `{{ expression }}` templates in strings
+var templatePattern = regexp.MustCompile(`{{.*?}}`)
+
+// Templates - the compiled expressions of the `{{ }}` templates of a value, keyed by their script
+// a task additionally holds its `assert` conditions and `retry_on` filters
+type Templates map[string]*Expression
+
+// Expression - returns the compiled expression of the script
+// a script which has not been compiled is compiled on every evaluation
+func (t Templates) Expression(script string) *Expression {
+	if expr, ok := t[script]; ok {
+		return expr
+	}
+	return &Expression{Script: script}
+}
+
+// add - compiles the script and adds it to the templates
+func (t Templates) add(cache programs, script string) error {
+	if _, ok := t[script]; ok {
+		return nil
+	}
+	expr := &Expression{Script: script}
+	if err := expr.compile(cache); err != nil {
+		return err
+	}
+	t[script] = expr
+	return nil
+}
+
+// addValue - compiles the templates in all strings of the value, maps and lists are searched recursively
+func (t Templates) addValue(cache programs, value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		for _, m := range templatePattern.FindAllString(v, -1) {
+			if err := t.add(cache, strings.TrimSpace(m[2:len(m)-2])); err != nil {
+				return err
+			}
+		}
+
+	case []interface{}:
+		for _, entry := range v {
+			if err := t.addValue(cache, entry); err != nil {
+				return err
+			}
+		}
+
+	case map[string]interface{}:
+		for _, entry := range v {
+			if err := t.addValue(cache, entry); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// RenderTemplates - replaces all `{{ expression }}` templates in the string with the result of render for their script
+func RenderTemplates(value string, render func(script string) (string, error)) (string, error) {
+	var err error
+	result := templatePattern.ReplaceAllStringFunc(value, func(m string) string {
+		if err != nil {
+			return ""
+		}
+		var v string
+		v, err = render(strings.TrimSpace(m[2 : len(m)-2]))
+		return v
+	})
+	return result, err
+}
+
+// SingleTemplate - returns the script if the value is a string which only consists of one template
+func SingleTemplate(value interface{}) (string, bool) {
+	s, ok := value.(string)
+	if !ok {
+		return "", false
+	}
+	s = strings.TrimSpace(s)
+	m := templatePattern.FindStringIndex(s)
+	if m == nil || m[0] != 0 || m[1] != len(s) {
+		return "", false
+	}
+	return strings.TrimSpace(s[2 : len(s)-2]), true
+}
+
+// Compile - compiles all expressions and templates of a pipeline which has been decoded instead of parsed,
+// e.g. a pipeline which has been sent along with a job, parsed pipelines are compiled already
+func (p *Pipeline) Compile() error {
+	return p.compile(make(programs))
+}
+
+// compile - compiles all expressions and templates of the pipeline and its sub-pipelines
+// the cache holds the programs which have already been compiled while parsing the pipeline
+func (p *Pipeline) compile(cache programs) error {
+	if err := compileVariables(cache, p.Variables); err != nil {
+		return err
+	}
+	for i := range p.Stages {
+		if err := p.Stages[i].compile(cache); err != nil {
+			return err
+		}
+	}
+	for _, tasks := range [][]Task{p.Handlers, p.OnFailure, p.Always} {
+		if err := compileTasks(cache, tasks); err != nil {
+			return err
+		}
+	}
+	for i := range p.Outputs {
+		if err := compileExpressions(cache, &p.Outputs[i].Value); err != nil {
+			return err
+		}
+	}
+	for _, sub := range p.Pipelines {
+		if err := sub.compile(cache); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Stage) compile(cache programs) error {
+	if err := compileExpressions(cache, &s.When, &s.Until); err != nil {
+		return err
+	}
+	if err := compileVariables(cache, s.Variables); err != nil {
+		return err
+	}
+	for _, tasks := range [][]Task{s.Tasks, s.OnFailure, s.Always} {
+		if err := compileTasks(cache, tasks); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *Task) compile(cache programs) error {
+	if err := compileExpressions(cache, &t.When, &t.Loop); err != nil {
+		return err
+	}
+	if err := compileVariables(cache, t.Variables); err != nil {
+		return err
+	}
+
+	t.Templates = make(Templates)
+	if err := t.Templates.addValue(cache, t.Parameters); err != nil {
+		return err
+	}
+	if t.Local == AssertTask {
+		for _, condition := range t.Conditions() {
+			if err := t.Templates.add(cache, condition); err != nil {
+				return err
+			}
+		}
+	}
+	for _, filter := range t.Retry.On {
+		if IsErrorClass(filter) {
+			continue
+		}
+		if err := t.Templates.add(cache, filter); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compileExpressions - compiles the expressions, expressions which are not set are skipped
+func compileExpressions(cache programs, expressions ...*Expression) error {
+	for _, expr := range expressions {
+		if expr.Script == "" {
+			continue
+		}
+		if err := expr.compile(cache); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func compileTasks(cache programs, tasks []Task) error {
+	for i := range tasks {
+		if err := tasks[i].compile(cache); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func compileVariables(cache programs, variables []Variable) error {
+	for i := range variables {
+		variables[i].Templates = make(Templates)
+		if err := variables[i].Templates.addValue(cache, variables[i].Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
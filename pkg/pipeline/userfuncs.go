@@ -1,12 +1,168 @@
 package pipeline
 
 import (
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+
 	"github.com/d5/tengo/v2"
+	"github.com/d5/tengo/v2/stdlib"
+	"github.com/d5/tengo/v2/token"
 	"github.com/google/uuid"
+	"github.com/ko1N/dips/pkg/taskstorage"
 )
 
-var userFunctions = map[string](func(args ...tengo.Object) (tengo.Object, error)){
-	"uuid": tuuid,
+// registry - functions and stdlib modules which are available to all expressions
+// embedding programs register additional functions before pipelines are parsed or compiled,
+// pipelines which have been compiled before do not see them, expressions are evaluated concurrently
+var registry = struct {
+	sync.RWMutex
+	functions map[string]tengo.CallableFunc
+	modules   []string
+}{
+	functions: map[string]tengo.CallableFunc{
+		"uuid":           tuuid,
+		"basename":       tbasename,
+		"dirname":        tdirname,
+		"ext":            tfileExt,
+		"url_join":       turlJoin,
+		"parse_file_url": tparseFileURL,
+		"default":        tdefault,
+		"env":            tenv,
+	},
+	// only modules without access to the host are allowed by default, `env` cannot read any variable by default
+	modules: []string{"text", "json", "times", "fmt", "math"},
+}
+
+// RegisterFunction - makes the function available to all expressions under the given name
+// the name must be a valid identifier which is not used by a builtin function or an enabled module
+func RegisterFunction(name string, fn tengo.CallableFunc) error {
+	if token.Lookup(name) != token.Ident || !isIdentifier(name) {
+		return fmt.Errorf("`%s` is not a valid function name", name)
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.functions[name]; ok || contains(registry.modules, name) || contains(inputFunctions, name) {
+		return fmt.Errorf("function `%s` is already defined", name)
+	}
+	registry.functions[name] = fn
+	return nil
+}
+
+// EnableModule - adds a module of the tengo stdlib to the allow-list
+// enabled modules are available as a global with their name and via `import`
+func EnableModule(name string) error {
+	if _, ok := stdlib.BuiltinModules[name]; !ok {
+		return fmt.Errorf("unknown module `%s`", name)
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+	if _, ok := registry.functions[name]; ok {
+		return fmt.Errorf("module `%s` conflicts with a function of the same name", name)
+	}
+	if !contains(registry.modules, name) {
+		registry.modules = append(registry.modules, name)
+	}
+	return nil
+}
+
+// hostFunctions - functions which read from the host the expression is evaluated on
+var hostFunctions = []string{"env"}
+
+// allowedEnv - environment variables `env` can read, entries ending with `*` are prefixes
+var allowedEnv struct {
+	sync.RWMutex
+	names []string
+}
+
+// AllowEnv - adds environment variables to the allow-list of `env`
+// a name ending with `*` allows all variables with the given prefix, e.g. `DIPS_*`
+func AllowEnv(names ...string) {
+	allowedEnv.Lock()
+	defer allowedEnv.Unlock()
+	for _, name := range names {
+		if name != "" && !contains(allowedEnv.names, name) {
+			allowedEnv.names = append(allowedEnv.names, name)
+		}
+	}
+}
+
+// DisallowEnv - removes entries from the allow-list of `env`, prefixes are removed by the same entry they have been allowed with
+func DisallowEnv(names ...string) {
+	allowedEnv.Lock()
+	defer allowedEnv.Unlock()
+	result := allowedEnv.names[:0]
+	for _, allowed := range allowedEnv.names {
+		if !contains(names, allowed) {
+			result = append(result, allowed)
+		}
+	}
+	allowedEnv.names = result
+}
+
+// envAllowed - checks if `env` can read the environment variable
+func envAllowed(name string) bool {
+	allowedEnv.RLock()
+	defer allowedEnv.RUnlock()
+	for _, allowed := range allowedEnv.names {
+		if allowed == name || (strings.HasSuffix(allowed, "*") && strings.HasPrefix(name, allowed[:len(allowed)-1])) {
+			return true
+		}
+	}
+	return false
+}
+
+// globals - returns all enabled modules and registered functions
+func globals() map[string]tengo.Object {
+	registry.RLock()
+	defer registry.RUnlock()
+
+	result := make(map[string]tengo.Object, len(registry.modules)+len(registry.functions))
+	for _, name := range registry.modules {
+		result[name] = &tengo.ImmutableMap{Value: stdlib.BuiltinModules[name]}
+	}
+	for name, fn := range registry.functions {
+		result[name] = &tengo.UserFunction{
+			Name:  name,
+			Value: fn,
+		}
+	}
+	return result
+}
+
+// modules - returns the module map of all enabled modules
+func modules() *tengo.ModuleMap {
+	registry.RLock()
+	defer registry.RUnlock()
+	return stdlib.GetModuleMap(registry.modules...)
+}
+
+func isIdentifier(name string) bool {
+	for i, c := range name {
+		letter := c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+		if !letter && (i == 0 || c < '0' || c > '9') {
+			return false
+		}
+	}
+	return name != ""
+}
+
+// stringArg - returns the argument at index i as a string
+func stringArg(args []tengo.Object, i int, name string) (string, error) {
+	s, ok := tengo.ToString(args[i])
+	if !ok {
+		return "", tengo.ErrInvalidArgumentType{
+			Name:     name,
+			Expected: "string",
+			Found:    args[i].TypeName(),
+		}
+	}
+	return s, nil
 }
 
 func tuuid(args ...tengo.Object) (tengo.Object, error) {
@@ -17,3 +173,110 @@ func tuuid(args ...tengo.Object) (tengo.Object, error) {
 	u := uuid.New().String()
 	return tengo.FromInterface(u)
 }
+
+// pathFunction - wraps a function of the path package which takes a single path
+// for urls like `minio://host/bucket/file.mp4` the function is applied to the path of the url,
+// if keepURL is set the url with the resulting path is returned instead of just the result
+func pathFunction(fn func(string) string, keepURL bool) tengo.CallableFunc {
+	return func(args ...tengo.Object) (tengo.Object, error) {
+		if len(args) != 1 {
+			return nil, tengo.ErrWrongNumArguments
+		}
+		p, err := stringArg(args, 0, "path")
+		if err != nil {
+			return nil, err
+		}
+		if u, err := url.Parse(p); err == nil && u.Scheme != "" {
+			if !keepURL {
+				return &tengo.String{Value: fn(u.Path)}, nil
+			}
+			u.Path = fn(u.Path)
+			return &tengo.String{Value: u.String()}, nil
+		}
+		return &tengo.String{Value: fn(p)}, nil
+	}
+}
+
+var tbasename = pathFunction(path.Base, false)
+var tdirname = pathFunction(path.Dir, true)
+var tfileExt = pathFunction(path.Ext, false)
+
+// turlJoin - appends the given elements to the path of the url
+func turlJoin(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) < 1 {
+		return nil, tengo.ErrWrongNumArguments
+	}
+	base, err := stringArg(args, 0, "url")
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+
+	elems := []string{u.Path}
+	for i := 1; i < len(args); i++ {
+		elem, err := stringArg(args, i, "element")
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, elem)
+	}
+	u.Path = path.Join(elems...)
+	return &tengo.String{Value: u.String()}, nil
+}
+
+// tparseFileURL - splits a file url into its storage, path, directory and file name
+func tparseFileURL(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 1 {
+		return nil, tengo.ErrWrongNumArguments
+	}
+	s, err := stringArg(args, 0, "url")
+	if err != nil {
+		return nil, err
+	}
+	fileURL, err := taskstorage.ParseFileUrl(s)
+	if err != nil {
+		return nil, err
+	}
+	return tengo.FromInterface(map[string]interface{}{
+		"url":      fileURL.URL.String(),
+		"scheme":   fileURL.URL.Scheme,
+		"host":     fileURL.URL.Host,
+		"storage":  fileURL.Storage,
+		"path":     fileURL.FilePath,
+		"dir":      fileURL.Dir,
+		"filename": fileURL.FileName,
+	})
+}
+
+// tdefault - returns the fallback if the value is undefined, e.g. a missing key of a map
+func tdefault(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 2 {
+		return nil, tengo.ErrWrongNumArguments
+	}
+	if args[0] == tengo.UndefinedValue {
+		return args[1], nil
+	}
+	return args[0], nil
+}
+
+// tenv - returns the environment variable of the process, the fallback or undefined if it is not set
+// variables which are not on the allow-list of AllowEnv are treated as if they were not set
+func tenv(args ...tengo.Object) (tengo.Object, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, tengo.ErrWrongNumArguments
+	}
+	name, err := stringArg(args, 0, "name")
+	if err != nil {
+		return nil, err
+	}
+	if value, ok := os.LookupEnv(name); ok && envAllowed(name) {
+		return &tengo.String{Value: value}, nil
+	}
+	if len(args) == 2 {
+		return args[1], nil
+	}
+	return tengo.UndefinedValue, nil
+}
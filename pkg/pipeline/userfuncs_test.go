@@ -0,0 +1,129 @@
+package pipeline
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/d5/tengo/v2"
+)
+
+func evaluate(t *testing.T, script string, variables map[string]interface{}) string {
+	t.Helper()
+	result, err := (&Expression{Script: script}).Evaluate(variables)
+	if err != nil {
+		t.Fatalf("%s: unexpected error: %s", script, err)
+	}
+	return result
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	variables := map[string]interface{}{
+		"source": "minio://localhost:9000/input/videos/bunny.mp4",
+		"probe":  map[string]interface{}{"codec": "h264"},
+	}
+	expects := map[string]string{
+		`basename(source)`:                           "bunny.mp4",
+		`basename("/tmp/out.mkv")`:                   "out.mkv",
+		`dirname(source)`:                            "minio://localhost:9000/input/videos",
+		`ext(source)`:                                ".mp4",
+		`url_join(dirname(source), "720p", "a.mp4")`: "minio://localhost:9000/input/videos/720p/a.mp4",
+		`parse_file_url(source).storage`:             "input",
+		`parse_file_url(source).filename`:            "bunny.mp4",
+		`default(probe.codec, "none")`:               "h264",
+		`default(probe.height, 720)`:                 "720",
+		`len(uuid())`:                                "36",
+		`text.to_upper(probe.codec)`:                 "H264",
+		`fmt.sprintf("%dp", 480)`:                    "480p",
+		`math.max(2, 3)`:                             "3",
+	}
+	for script, expected := range expects {
+		if result := evaluate(t, script, variables); result != expected {
+			t.Errorf("%s = %q, expected %q", script, result, expected)
+		}
+	}
+}
+
+func TestHostModulesAreDisabled(t *testing.T) {
+	for _, script := range []string{`os.getenv("HOME")`, `import("os").getenv("HOME")`} {
+		if _, err := (&Expression{Script: script}).Evaluate(map[string]interface{}{}); err == nil {
+			t.Errorf("%s has access to the host", script)
+		}
+	}
+}
+
+func TestRegisterFunction(t *testing.T) {
+	double := func(args ...tengo.Object) (tengo.Object, error) {
+		i, _ := tengo.ToInt64(args[0])
+		return &tengo.Int{Value: i * 2}, nil
+	}
+	if err := RegisterFunction("double", double); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	t.Cleanup(func() {
+		registry.Lock()
+		delete(registry.functions, "double")
+		registry.Unlock()
+	})
+
+	if result := evaluate(t, "double(21)", map[string]interface{}{}); result != "42" {
+		t.Errorf("double(21) = %s, expected 42", result)
+	}
+
+	invalid := map[string]string{
+		"double":  "already defined",
+		"default": "already defined",
+		"text":    "already defined",
+		"secret":  "already defined",
+		"if":      "not a valid function name",
+		"2x":      "not a valid function name",
+	}
+	for name, expected := range invalid {
+		if err := RegisterFunction(name, double); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("RegisterFunction(%q) = %v, expected %q", name, err, expected)
+		}
+	}
+}
+
+func TestEnableModule(t *testing.T) {
+	if err := EnableModule("network"); err == nil {
+		t.Errorf("an unknown module has been enabled")
+	}
+
+	if err := EnableModule("rand"); err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	t.Cleanup(func() {
+		registry.Lock()
+		registry.modules = registry.modules[:len(registry.modules)-1]
+		registry.Unlock()
+	})
+
+	if result := evaluate(t, `rand.intn(1) + import("rand").intn(1)`, map[string]interface{}{}); result != "0" {
+		t.Errorf("rand = %s, expected 0", result)
+	}
+}
+
+func TestEnvAllowList(t *testing.T) {
+	t.Setenv("DIPS_TEST_NAME", "name")
+	t.Setenv("DIPS_PREFIX_VALUE", "prefix")
+	t.Setenv("DIPS_TEST_OTHER", "other")
+
+	empty := map[string]interface{}{}
+	script := `[env("DIPS_TEST_NAME", "unset"), env("DIPS_PREFIX_VALUE", "unset"), env("DIPS_TEST_OTHER", "unset"), is_undefined(env("DIPS_TEST_OTHER"))]`
+
+	// variables which are not allowed are treated as unset
+	if result := evaluate(t, script, empty); result != `["unset", "unset", "unset", true]` {
+		t.Errorf("without an allow-list: %s", result)
+	}
+
+	AllowEnv("DIPS_TEST_NAME", "DIPS_PREFIX_*", "")
+	t.Cleanup(func() { DisallowEnv("DIPS_TEST_NAME", "DIPS_PREFIX_*") })
+	if result := evaluate(t, script, empty); result != `["name", "prefix", "unset", true]` {
+		t.Errorf("with names and prefixes: %s", result)
+	}
+
+	DisallowEnv("DIPS_PREFIX_*")
+	if result := evaluate(t, script, empty); result != `["name", "unset", "unset", true]` {
+		t.Errorf("after removing the prefix: %s", result)
+	}
+}
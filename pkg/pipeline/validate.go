@@ -0,0 +1,285 @@
+package pipeline
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// patternMessages - readable descriptions of the patterns used in the schema
+var patternMessages = map[string]string{
+	boolPattern:     "must be a bool",
+	intPattern:      "must be an int",
+	durationPattern: "must be a duration like `30s` or `1h30m`",
+}
+
+// typeNames - how json types are called in diagnostics
+var typeNames = map[string]string{
+	"object":  "a mapping",
+	"array":   "a list",
+	"string":  "a string",
+	"integer": "an int",
+	"number":  "a number",
+	"boolean": "a bool",
+	"null":    "null",
+}
+
+// schemaError - a single violation of the schema
+type schemaError struct {
+	node    *yaml.Node
+	message string
+}
+
+// validator - checks yaml nodes against the definitions of a schema
+type validator struct {
+	root *Schema
+}
+
+// validate - checks the node against the schema of the parser and reports all violations
+func (d *decoder) validate(node *yaml.Node, schema *Schema, what string) bool {
+	v := validator{d.schema}
+	errs := v.check(node, schema, what)
+	for _, err := range errs {
+		d.errorf(err.node, "%s", err.message)
+	}
+	return len(errs) == 0
+}
+
+// entries - returns the schema of the entries of a list in a definition of the parser schema
+func entries(name string, key string) *Schema {
+	return parserSchema.Definitions[name].Properties[key].Items
+}
+
+// fragment - included files contain either a single entry or a list of entries
+func fragment(entry *Schema) *Schema {
+	return anyOf(entry, list(entry))
+}
+
+func (v *validator) resolve(s *Schema) *Schema {
+	for s.Ref != "" {
+		s = v.root.Definitions[strings.TrimPrefix(s.Ref, "#/definitions/")]
+	}
+	return s
+}
+
+// check - returns all violations of the schema, the node is described as `what` unless the schema has a title
+func (v *validator) check(node *yaml.Node, s *Schema, what string) []schemaError {
+	node = resolve(node)
+	s = v.resolve(s)
+	if s.Title != "" {
+		what = s.Title
+	}
+
+	if len(s.AnyOf) > 0 {
+		if errs := v.anyOf(node, s.AnyOf, what); len(errs) > 0 {
+			return errs
+		}
+	}
+
+	if len(s.Type) > 0 && !matchesType(node, s.Type) {
+		return []schemaError{{node, what + " must be " + describeTypes(s.Type)}}
+	}
+
+	var errs []schemaError
+	switch node.Kind {
+	case yaml.MappingNode:
+		errs = v.object(node, s, what)
+
+	case yaml.SequenceNode:
+		if s.Items != nil {
+			for _, entry := range node.Content {
+				errs = append(errs, v.check(entry, s.Items, "entries in "+what)...)
+			}
+		}
+
+	case yaml.ScalarNode:
+		errs = v.scalar(node, s, what)
+	}
+
+	if len(errs) == 0 && len(s.OneOf) > 0 {
+		errs = v.oneOf(node, s.OneOf, what)
+	}
+	return errs
+}
+
+func (v *validator) object(node *yaml.Node, s *Schema, what string) []schemaError {
+	var errs []schemaError
+	for _, key := range s.Required {
+		if findKey(node, key) == nil {
+			errs = append(errs, schemaError{node, what + " is missing `" + key + "`"})
+		}
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		keyNode, value := node.Content[i], node.Content[i+1]
+		if prop, ok := s.Properties[keyNode.Value]; ok {
+			errs = append(errs, v.check(value, prop, keyNode.Value)...)
+			continue
+		}
+		switch additional := s.AdditionalProperties.(type) {
+		case bool:
+			if !additional {
+				msg := "unknown key `" + keyNode.Value + "` in " + what
+				if s.unknownKey != "" {
+					msg += ", " + s.unknownKey
+				}
+				errs = append(errs, schemaError{keyNode, msg})
+			}
+		case *Schema:
+			errs = append(errs, v.check(value, additional, keyNode.Value)...)
+		}
+	}
+	return errs
+}
+
+func (v *validator) scalar(node *yaml.Node, s *Schema, what string) []schemaError {
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if fmt.Sprint(e) == node.Value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return []schemaError{{node, fmt.Sprintf("%s must be one of %v", what, s.Enum)}}
+		}
+	}
+
+	if s.Pattern != "" && !regexp.MustCompile(s.Pattern).MatchString(node.Value) {
+		msg, ok := patternMessages[s.Pattern]
+		if !ok {
+			msg = "must match `" + s.Pattern + "`"
+		}
+		return []schemaError{{node, what + " " + msg}}
+	}
+
+	if s.Minimum != nil {
+		if n, err := strconv.Atoi(node.Value); err == nil && n < *s.Minimum {
+			return []schemaError{{node, fmt.Sprintf("%s must be at least %d", what, *s.Minimum)}}
+		}
+	}
+	if s.Maximum != nil {
+		if n, err := strconv.Atoi(node.Value); err == nil && n > *s.Maximum {
+			return []schemaError{{node, fmt.Sprintf("%s must be at most %d", what, *s.Maximum)}}
+		}
+	}
+	return nil
+}
+
+// anyOf - returns nil if any alternative matches, otherwise the violations of the closest alternative
+// the closest alternative has the type of the node and, for mappings, all of its required keys
+func (v *validator) anyOf(node *yaml.Node, alternatives []*Schema, what string) []schemaError {
+	var candidates []*Schema
+	var types SchemaTypes
+	for _, alt := range alternatives {
+		errs := v.check(node, alt, what)
+		if len(errs) == 0 {
+			return nil
+		}
+
+		alt = v.resolve(alt)
+		types = append(types, alt.Type...)
+		if len(alt.Type) == 0 || matchesType(node, alt.Type) {
+			candidates = append(candidates, alt)
+		}
+	}
+
+	if len(candidates) == 0 {
+		// alternatives like quoted booleans are described by their pattern instead of their type
+		for _, alt := range alternatives {
+			if msg, ok := patternMessages[v.resolve(alt).Pattern]; ok {
+				return []schemaError{{node, what + " " + msg}}
+			}
+		}
+		return []schemaError{{node, what + " must be " + describeTypes(types)}}
+	}
+
+	closest := candidates[len(candidates)-1]
+	for _, c := range candidates {
+		if node.Kind == yaml.MappingNode && len(c.Required) > 0 && hasKeys(node, c.Required) {
+			closest = c
+			break
+		}
+	}
+	return v.check(node, closest, what)
+}
+
+// oneOf - exactly one alternative has to match, alternatives usually only consist of required keys
+func (v *validator) oneOf(node *yaml.Node, alternatives []*Schema, what string) []schemaError {
+	var keys []string
+	matches := 0
+	for _, alt := range alternatives {
+		if len(v.check(node, alt, what)) == 0 {
+			matches++
+		}
+		keys = append(keys, v.resolve(alt).Required...)
+	}
+	if matches == 1 {
+		return nil
+	}
+
+	quoted := make([]string, len(keys))
+	for i, key := range keys {
+		quoted[i] = "`" + key + "`"
+	}
+	if matches == 0 {
+		return []schemaError{{node, what + " requires one of " + strings.Join(quoted, ", ")}}
+	}
+	return []schemaError{{node, "only one of " + strings.Join(quoted, ", ") + " can be used"}}
+}
+
+// matchesType - checks the node against the json types, yaml scalars are typed by their tag
+func matchesType(node *yaml.Node, types SchemaTypes) bool {
+	var actual string
+	switch node.Kind {
+	case yaml.MappingNode:
+		actual = "object"
+	case yaml.SequenceNode:
+		actual = "array"
+	case yaml.ScalarNode:
+		switch node.Tag {
+		case "!!int":
+			actual = "integer"
+		case "!!float":
+			actual = "number"
+		case "!!bool":
+			actual = "boolean"
+		case "!!null":
+			actual = "null"
+		default:
+			actual = "string"
+		}
+	}
+
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func describeTypes(types SchemaTypes) string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, t := range types {
+		if !seen[t] {
+			seen[t] = true
+			names = append(names, typeNames[t])
+		}
+	}
+	return strings.Join(names, " or ")
+}
+
+func hasKeys(node *yaml.Node, keys []string) bool {
+	for _, key := range keys {
+		if findKey(node, key) == nil {
+			return false
+		}
+	}
+	return true
+}